@@ -2,38 +2,164 @@ package caching
 
 import (
 	"context"
-	"fmt"
 	"github.com/QuangTung97/go-memcache/memcache"
 	"github.com/QuangTung97/memproxy"
 	"github.com/QuangTung97/memproxy/item"
+	"github.com/QuangTung97/memproxy/proxy"
 	"github.com/jmoiron/sqlx"
+	"net"
+	"strconv"
+	"time"
 )
 
 type CacheRepoFactory struct {
 	mc       memproxy.Memcache
 	provider memproxy.SessionProvider
+	options  *cacheOptions
+	stats    *cacheStats
+
+	l1    *l1Cache
+	route *hashRoute
 
 	repo *Repository
 }
 
+type cacheOptions struct {
+	notFoundTTL uint32
+
+	l1Capacity int
+	l1TTL      time.Duration
+
+	virtualNodes int
+	hotKeys      []string
+	hotReplicas  int
+}
+
+// CacheOption ...
+type CacheOption func(opts *cacheOptions)
+
+// WithNotFoundTTL sets the TTL of the cached not found marker, default is 60 seconds
+func WithNotFoundTTL(d time.Duration) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.notFoundTTL = uint32(d / time.Second)
+	}
+}
+
+// WithL1Cache enables an in-process LRU cache in front of memcache, holding at most capacity products, each for ttl
+func WithL1Cache(capacity int, ttl time.Duration) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.l1Capacity = capacity
+		opts.l1TTL = ttl
+	}
+}
+
+// WithVirtualNodes sets the number of points of each memcache server on the hash ring, default is 160
+func WithVirtualNodes(n int) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.virtualNodes = n
+	}
+}
+
+// WithHotKeys replicates the products of hot skus on multiple memcache servers,
+// reads choose a random replica, invalidations delete all replicas
+func WithHotKeys(replicas int, skus []string) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.hotReplicas = replicas
+		opts.hotKeys = skus
+	}
+}
+
+func computeCacheOptions(options []CacheOption) *cacheOptions {
+	opts := &cacheOptions{
+		notFoundTTL:  60,
+		virtualNodes: 160,
+	}
+	for _, fn := range options {
+		fn(opts)
+	}
+	return opts
+}
+
 type CacheRepo struct {
 	sess memproxy.Session
 	pipe memproxy.Pipeline
 
+	l1    *l1Cache
+	stats *cacheStats
+
 	productItem *item.Item[Product, ProductKey]
 }
 
-func NewCacheFactory(memcacheAddr string, db *sqlx.DB) *CacheRepoFactory {
-	client, err := memcache.New(memcacheAddr, 4)
+func newPlainMemcache(addr string) memproxy.Memcache {
+	client, err := memcache.New(addr, 4)
 	if err != nil {
 		panic(err)
 	}
+	return memproxy.NewPlainMemcache(client, 3)
+}
+
+func parseServerConfigs(addrs []string) []proxy.SimpleServerConfig {
+	servers := make([]proxy.SimpleServerConfig, 0, len(addrs))
+	for i, addr := range addrs {
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			panic(err)
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			panic(err)
+		}
+
+		servers = append(servers, proxy.SimpleServerConfig{
+			ID:   proxy.ServerID(i + 1),
+			Host: host,
+			Port: uint16(port),
+		})
+	}
+	return servers
+}
+
+// NewCacheFactory with more than one memcache address routes keys by consistent hashing
+func NewCacheFactory(memcacheAddrs []string, db *sqlx.DB, options ...CacheOption) *CacheRepoFactory {
+	opts := computeCacheOptions(options)
+
+	var mc memproxy.Memcache
+	var route *hashRoute
+
+	if len(memcacheAddrs) == 1 {
+		mc = newPlainMemcache(memcacheAddrs[0])
+	} else {
+		servers := parseServerConfigs(memcacheAddrs)
+		route = newHashRoute(servers, opts.virtualNodes, opts.hotKeys, opts.hotReplicas)
+
+		var err error
+		mc, err = proxy.New[proxy.SimpleServerConfig](
+			proxy.Config[proxy.SimpleServerConfig]{
+				Servers: servers,
+				Route:   route,
+			},
+			func(conf proxy.SimpleServerConfig) memproxy.Memcache {
+				return newPlainMemcache(conf.Address())
+			},
+		)
+		if err != nil {
+			panic(err)
+		}
+	}
 
-	mc := memproxy.NewPlainMemcache(client, 3)
+	var l1 *l1Cache
+	if opts.l1Capacity > 0 {
+		l1 = newL1Cache(opts.l1Capacity, opts.l1TTL, time.Now)
+	}
 
 	return &CacheRepoFactory{
 		mc:       mc,
 		provider: memproxy.NewSessionProvider(),
+		options:  opts,
+		stats:    &cacheStats{},
+
+		l1:    l1,
+		route: route,
 
 		repo: NewRepository(db),
 	}
@@ -47,50 +173,184 @@ func mapSlice[A any, B any](input []A, mapFunc func(x A) B) []B {
 	return result
 }
 
+// newPipeline is the memcache pipeline of CacheRepo and the warmer, with the TTL policy.
+// stats is nil for the warmer, the warm up must not change the ratios of the benchmarks
+func (f *CacheRepoFactory) newPipeline(ctx context.Context, sess memproxy.Session, stats *cacheStats) memproxy.Pipeline {
+	return newCachePipeline(f.mc.Pipeline(ctx, sess), f.options, stats)
+}
+
 func (f *CacheRepoFactory) NewRepo() *CacheRepo {
 	sess := f.provider.New()
-	pipe := f.mc.Pipeline(context.Background(), sess)
+	pipe := f.newPipeline(context.Background(), sess, f.stats)
 
 	productItem := item.New[Product, ProductKey](
 		pipe,
 		unmarshalProduct,
 		item.NewMultiGetFiller[Product, ProductKey](
 			func(ctx context.Context, keys []ProductKey) ([]Product, error) {
-				fmt.Println("KEY LEN:", len(keys))
-
+				start := time.Now()
 				contents, err := f.repo.GetProducts(ctx, mapSlice(keys, func(x ProductKey) string {
 					return x.SKU
 				}))
+				f.stats.observeFiller(len(keys), time.Since(start), err)
 				if err != nil {
 					return nil, err
 				}
 
-				return mapSlice(contents, func(x ProductContent) Product {
-					product, err := unmarshalProduct(x.ContentData)
-					if err != nil {
-						panic(err)
-					}
-					return product
-				}), nil
+				return productsFromContents(keys, contents), nil
 			}, Product.GetKey,
 		),
 	)
 
 	return &CacheRepo{
-		sess:        sess,
-		pipe:        pipe,
+		sess: sess,
+		pipe: pipe,
+
+		l1:    f.l1,
+		stats: f.stats,
+
 		productItem: productItem,
 	}
 }
 
+// UpdateProducts writes products to the database, then invalidates their cache keys.
+// A fill that read the old row holds a lease deleted by the invalidation, so its lease set is not stored
+func (f *CacheRepoFactory) UpdateProducts(ctx context.Context, products []Product) error {
+	err := f.repo.UpdateProducts(ctx, mapSlice(products, ProductContentFromProduct))
+	if err != nil {
+		return err
+	}
+
+	return f.invalidate(ctx, mapSlice(products, func(x Product) string {
+		return x.Sku
+	}))
+}
+
+// DeleteProducts deletes products from the database, then invalidates their cache keys
+func (f *CacheRepoFactory) DeleteProducts(ctx context.Context, skus []string) error {
+	err := f.repo.DeleteProducts(ctx, skus)
+	if err != nil {
+		return err
+	}
+	return f.invalidate(ctx, skus)
+}
+
+func (f *CacheRepoFactory) invalidate(ctx context.Context, skus []string) error {
+	repo := f.NewRepo()
+	defer repo.Finish()
+
+	return repo.InvalidateProducts(ctx, skus)()
+}
+
+// productsFromContents returns one product for every key, missing skus become not found markers
+func productsFromContents(keys []ProductKey, contents []ProductContent) []Product {
+	result := make([]Product, 0, len(keys))
+	found := make(map[string]struct{}, len(contents))
+
+	for _, c := range contents {
+		found[c.SKU] = struct{}{}
+
+		product, err := unmarshalProduct(c.ContentData)
+		if err != nil {
+			result = append(result, corruptProduct(c.SKU, err))
+			continue
+		}
+		result = append(result, product)
+	}
+
+	for _, k := range keys {
+		if _, ok := found[k.SKU]; !ok {
+			result = append(result, notFoundProduct(k.SKU))
+		}
+	}
+	return result
+}
+
+// Stats returns a snapshot of the cache counters
+func (f *CacheRepoFactory) Stats() CacheStats {
+	return f.stats.snapshot()
+}
+
+// NodeStats returns per memcache server counters, empty with a single server
+func (f *CacheRepoFactory) NodeStats() map[proxy.ServerID]NodeStats {
+	if f.route == nil {
+		return nil
+	}
+	return f.route.nodeStats()
+}
+
+// InvalidateL1 is the invalidation hook for the in-process cache, e.g. for updates made by other processes
+func (f *CacheRepoFactory) InvalidateL1(skus []string) {
+	if f.l1 != nil {
+		f.l1.invalidate(skus)
+	}
+}
+
 func (f *CacheRepoFactory) Close() error {
 	return f.mc.Close()
 }
 
+func productResult(sku string, product Product) (Product, error) {
+	if product.notFound {
+		return Product{}, ProductNotFoundError{SKU: sku}
+	}
+	return product, nil
+}
+
+// GetProduct returns ProductNotFoundError if the sku does not exist
 func (r *CacheRepo) GetProduct(ctx context.Context, sku string) func() (Product, error) {
-	return r.productItem.Get(ctx, ProductKey{
+	r.stats.gets.Add(1)
+	start := time.Now()
+
+	if r.l1 != nil {
+		product, ok := r.l1.get(sku)
+		if ok {
+			r.stats.l1Hits.Add(1)
+			r.stats.l1Latency.observe(time.Since(start))
+			return func() (Product, error) {
+				return productResult(sku, product)
+			}
+		}
+		r.stats.l1Misses.Add(1)
+	}
+
+	fn := r.productItem.Get(ctx, ProductKey{
 		SKU: sku,
 	})
+	return func() (Product, error) {
+		product, err := fn()
+		r.stats.memcacheLatency.observe(time.Since(start))
+		if err != nil {
+			return Product{}, err
+		}
+		if r.l1 != nil {
+			r.l1.put(sku, product)
+		}
+		return productResult(sku, product)
+	}
+}
+
+// InvalidateProducts deletes the cache keys, must be called after the database is updated.
+// A concurrent filler holding a lease for the same key will fail its lease set
+func (r *CacheRepo) InvalidateProducts(_ context.Context, skus []string) func() error {
+	if r.l1 != nil {
+		r.l1.invalidate(skus)
+	}
+
+	fnList := make([]func() (memproxy.DeleteResponse, error), 0, len(skus))
+	for _, sku := range skus {
+		key := ProductKey{SKU: sku}
+		fnList = append(fnList, r.pipe.Delete(key.String(), memproxy.DeleteOptions{}))
+	}
+
+	return func() error {
+		for _, fn := range fnList {
+			if _, err := fn(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 }
 
 func (r *CacheRepo) Finish() {
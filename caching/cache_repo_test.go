@@ -1,18 +1,31 @@
 package caching
 
 import (
+	"bench_elastic/pb"
 	"context"
 	"fmt"
 	"math/rand"
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
+var memcacheAddrs = []string{"localhost:11211"}
+
+var multiNodeMemcacheAddrs = []string{
+	"localhost:11211",
+	"localhost:11212",
+	"localhost:11213",
+	"localhost:11214",
+}
+
 func TestCacheRepo(t *testing.T) {
-	f := NewCacheFactory("localhost:11211", NewDB())
+	f := NewCacheFactory(memcacheAddrs, NewDB())
 	defer func() { _ = f.Close() }()
 
 	repo := f.NewRepo()
@@ -23,6 +36,32 @@ func TestCacheRepo(t *testing.T) {
 	fmt.Println(product, err, time.Since(start))
 }
 
+func TestProductsFromContents(t *testing.T) {
+	content := ProductContentFromProduct(Product{
+		Product: &pb.Product{Sku: "SKU001", Name: "Name 1"},
+	})
+
+	products := productsFromContents(
+		[]ProductKey{{SKU: "SKU001"}, {SKU: "SKU002"}, {SKU: "SKU003"}},
+		[]ProductContent{
+			content,
+			{SKU: "SKU003", ContentData: []byte{0xff, 0xff}},
+		},
+	)
+
+	assert.Equal(t, 3, len(products))
+
+	assert.Equal(t, "Name 1", products[0].Name)
+	assert.Equal(t, false, products[0].notFound)
+	assert.Equal(t, nil, products[0].err)
+
+	assert.Equal(t, ProductKey{SKU: "SKU003"}, products[1].GetKey())
+	assert.NotEqual(t, nil, products[1].err)
+
+	assert.Equal(t, ProductKey{SKU: "SKU002"}, products[2].GetKey())
+	assert.Equal(t, true, products[2].notFound)
+}
+
 func TestCacheRepo__Use_Only_Repo(t *testing.T) {
 	repo := NewRepository(NewDB())
 
@@ -45,7 +84,7 @@ func TestCacheRepo__Multi_Get_Products(t *testing.T) {
 
 	rand.Seed(time.Now().UnixNano())
 
-	f := NewCacheFactory("localhost:11211", NewDB())
+	f := NewCacheFactory(memcacheAddrs, NewDB())
 	defer func() { _ = f.Close() }()
 
 	const loops = 2000
@@ -111,4 +150,194 @@ func TestCacheRepo__Multi_Get_Products(t *testing.T) {
 	printPercentile("CACHE", durations, 0.9)
 	printPercentile("CACHE", durations, 0.95)
 	printPercentile("CACHE", durations, 0.99)
+
+	f.Stats().Print()
+}
+
+func productVersion(p Product) int64 {
+	var version int64
+	_, err := fmt.Sscanf(p.Field9, "version %d", &version)
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+func TestCacheRepo__Stale_Read_Rate(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	f := NewCacheFactory(memcacheAddrs, NewDB())
+	defer func() { _ = f.Close() }()
+
+	const numSKUs = 100
+	const numUpdaters = 4
+	const numReaders = 10
+	const loops = 2000
+
+	var skuMuts [numSKUs]sync.Mutex
+	var committed [numSKUs]atomic.Int64
+
+	var reads atomic.Int64
+	var staleReads atomic.Int64
+
+	var wg sync.WaitGroup
+	wg.Add(numUpdaters + numReaders)
+
+	for th := 0; th < numUpdaters; th++ {
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < loops; i++ {
+				index := rand.Intn(numSKUs)
+
+				skuMuts[index].Lock()
+
+				next := committed[index].Load() + 1
+				p := randomProduct(index)
+				p.Field9 = fmt.Sprintf("version %d", next)
+
+				err := f.UpdateProducts(context.Background(), []Product{p})
+				if err != nil {
+					panic(err)
+				}
+				committed[index].Store(next)
+
+				skuMuts[index].Unlock()
+			}
+		}()
+	}
+
+	for th := 0; th < numReaders; th++ {
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < loops; i++ {
+				index := rand.Intn(numSKUs)
+				before := committed[index].Load()
+
+				repo := f.NewRepo()
+				product, err := repo.GetProduct(context.Background(), fmt.Sprintf("SKU%08d", index))()
+				repo.Finish()
+				if err != nil {
+					panic(err)
+				}
+
+				reads.Add(1)
+				if productVersion(product) < before {
+					staleReads.Add(1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	fmt.Println("READS:", reads.Load())
+	fmt.Println("STALE READS:", staleReads.Load())
+	fmt.Printf("STALE RATE: %.4f%%\n", float64(staleReads.Load())*100/float64(reads.Load()))
+
+	f.Stats().Print()
+}
+
+func TestCacheRepo__Two_Tier_Zipf(t *testing.T) {
+	run := func(name string, options ...CacheOption) {
+		f := NewCacheFactory(memcacheAddrs, NewDB(), options...)
+		defer func() { _ = f.Close() }()
+
+		const loops = 2000
+		const numThreads = 10
+		const batchSize = 5
+
+		var wg sync.WaitGroup
+		wg.Add(numThreads)
+
+		for th := 0; th < numThreads; th++ {
+			seed := time.Now().UnixNano() + int64(th)
+			go func() {
+				defer wg.Done()
+
+				r := rand.New(rand.NewSource(seed))
+				zipf := rand.NewZipf(r, 1.1, 1, numberOfProducts-1)
+
+				for i := 0; i < loops; i++ {
+					repo := f.NewRepo()
+
+					fnList := make([]func() (Product, error), 0, batchSize)
+					for m := 0; m < batchSize; m++ {
+						sku := fmt.Sprintf("SKU%08d", zipf.Uint64())
+						fnList = append(fnList, repo.GetProduct(context.Background(), sku))
+					}
+					for _, fn := range fnList {
+						if _, err := fn(); err != nil {
+							panic(err)
+						}
+					}
+
+					repo.Finish()
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		fmt.Println("=========================================")
+		fmt.Println(name)
+		stats := f.Stats()
+		stats.Print()
+
+		// every get is recorded by the tier serving it
+		assert.Equal(t, int64(loops*numThreads*batchSize), stats.Gets)
+		assert.Equal(t, stats.Gets, stats.L1Latency.Count()+stats.MemcacheLatency.Count())
+		assert.Equal(t, stats.L1Hits, stats.L1Latency.Count())
+		if f.l1 != nil {
+			assert.Equal(t, stats.L1Misses, stats.MemcacheLatency.Count())
+		}
+	}
+
+	run("MEMCACHE ONLY")
+	run("L1 + MEMCACHE", WithL1Cache(100000, 30*time.Second))
+}
+
+func TestCacheRepo__Multi_Node_Rebalance(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	const numKeys = 20000
+	const batchSize = 40
+
+	readAll := func(f *CacheRepoFactory) {
+		for k := 0; k < numKeys; k += batchSize {
+			repo := f.NewRepo()
+
+			fnList := make([]func() (Product, error), 0, batchSize)
+			for i := k; i < k+batchSize; i++ {
+				fnList = append(fnList, repo.GetProduct(context.Background(), fmt.Sprintf("SKU%08d", i)))
+			}
+			for _, fn := range fnList {
+				if _, err := fn(); err != nil {
+					panic(err)
+				}
+			}
+
+			repo.Finish()
+		}
+	}
+
+	run := func(name string, addrs []string) {
+		f := NewCacheFactory(addrs, NewDB())
+		defer func() { _ = f.Close() }()
+
+		start := time.Now()
+		readAll(f)
+
+		fmt.Println("=========================================")
+		fmt.Println(name, "NODES:", len(addrs), "DURATION:", time.Since(start))
+		f.Stats().Print()
+		printNodeStats(f.NodeStats())
+	}
+
+	// the first run warms up the cache, the miss ratio of the next runs is the rebalancing cost
+	run("WARM UP", multiNodeMemcacheAddrs[:3])
+	run("SAME NODES", multiNodeMemcacheAddrs[:3])
+	run("NODE ADDED", multiNodeMemcacheAddrs)
+	run("NODE REMOVED", multiNodeMemcacheAddrs[1:])
 }
@@ -0,0 +1,159 @@
+package caching
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"github.com/golang/snappy"
+	"io"
+	"sync"
+)
+
+// Codec compresses the marshaled products stored in MySQL and memcache.
+// Encoded blobs start with a one byte header of the codec id, the ids are in range [1, 7]
+// because a protobuf message can not start with a field number 0, so blobs without header are still readable
+type Codec interface {
+	ID() byte
+	Name() string
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+const (
+	noneCodecID   byte = 1
+	flateCodecID  byte = 2
+	snappyCodecID byte = 3
+
+	maxCodecID byte = 7
+)
+
+type noneCodec struct {
+}
+
+// NoneCodec stores the protobuf bytes as is
+var NoneCodec Codec = noneCodec{}
+
+func (noneCodec) ID() byte {
+	return noneCodecID
+}
+
+func (noneCodec) Name() string {
+	return "none"
+}
+
+func (noneCodec) Encode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (noneCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+type flateCodec struct {
+	level   int
+	writers sync.Pool
+}
+
+// NewFlateCodec compresses with deflate, level is the same as flate.NewWriter
+func NewFlateCodec(level int) Codec {
+	return &flateCodec{
+		level: level,
+	}
+}
+
+func (*flateCodec) ID() byte {
+	return flateCodecID
+}
+
+func (c *flateCodec) Name() string {
+	return fmt.Sprintf("flate(%d)", c.level)
+}
+
+func (c *flateCodec) Encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, ok := c.writers.Get().(*flate.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		var err error
+		w, err = flate.NewWriter(&buf, c.level)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer c.writers.Put(w)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (*flateCodec) Decode(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer func() { _ = r.Close() }()
+	return io.ReadAll(r)
+}
+
+type snappyCodec struct {
+}
+
+// SnappyCodec is a fast LZ-style codec
+var SnappyCodec Codec = snappyCodec{}
+
+func (snappyCodec) ID() byte {
+	return snappyCodecID
+}
+
+func (snappyCodec) Name() string {
+	return "snappy"
+}
+
+func (snappyCodec) Encode(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCodec) Decode(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+var codecs = map[byte]Codec{
+	noneCodecID:   NoneCodec,
+	flateCodecID:  NewFlateCodec(flate.BestSpeed),
+	snappyCodecID: SnappyCodec,
+}
+
+// productCodec is used for encoding, decoding chooses the codec from the header
+var productCodec = NoneCodec
+
+// SetProductCodec changes the codec for newly marshaled products, it is NOT thread safe
+func SetProductCodec(codec Codec) {
+	productCodec = codec
+}
+
+func encodeBlob(codec Codec, data []byte) ([]byte, error) {
+	encoded, err := codec.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, len(encoded)+1)
+	result = append(result, codec.ID())
+	return append(result, encoded...), nil
+}
+
+func decodeBlob(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] > maxCodecID {
+		return data, nil
+	}
+
+	codec, ok := codecs[data[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec id: %d", data[0])
+	}
+	return codec.Decode(data[1:])
+}
@@ -0,0 +1,193 @@
+package caching
+
+import (
+	"bench_elastic/pb"
+	"compress/flate"
+	"fmt"
+	"github.com/QuangTung97/go-memcache/memcache"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var allCodecs = []Codec{
+	NoneCodec,
+	NewFlateCodec(flate.BestSpeed),
+	NewFlateCodec(flate.DefaultCompression),
+	SnappyCodec,
+}
+
+func TestCodec__Round_Trip(t *testing.T) {
+	p := randomProduct(10)
+
+	for _, codec := range allCodecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			SetProductCodec(codec)
+			defer SetProductCodec(NoneCodec)
+
+			data, err := p.Marshal()
+			assert.Equal(t, nil, err)
+			assert.Equal(t, codec.ID(), data[0])
+
+			result, err := unmarshalProduct(data)
+			assert.Equal(t, nil, err)
+			assert.True(t, proto.Equal(p.Product, result.Product))
+		})
+	}
+}
+
+func TestCodec__Read_Data_Without_Header(t *testing.T) {
+	p := randomProduct(10)
+
+	data, err := proto.Marshal(p.Product)
+	assert.Equal(t, nil, err)
+
+	result, err := unmarshalProduct(data)
+	assert.Equal(t, nil, err)
+	assert.True(t, proto.Equal(p.Product, result.Product))
+
+	result, err = unmarshalProduct(nil)
+	assert.Equal(t, nil, err)
+	assert.True(t, proto.Equal(&pb.Product{}, result.Product))
+}
+
+func TestCodec__Unknown_ID(t *testing.T) {
+	_, err := unmarshalProduct([]byte{5, 1, 2, 3})
+	assert.Equal(t, fmt.Errorf("unknown codec id: 5"), err)
+}
+
+func TestCodec__Sizes(t *testing.T) {
+	rand.Seed(randSeed)
+
+	const numProducts = 1000
+
+	products := make([]Product, 0, numProducts)
+	for i := 0; i < numProducts; i++ {
+		products = append(products, randomProduct(i))
+	}
+
+	for _, codec := range allCodecs {
+		total := 0
+		start := time.Now()
+		for _, p := range products {
+			data, err := proto.Marshal(p.Product)
+			if err != nil {
+				panic(err)
+			}
+			blob, err := encodeBlob(codec, data)
+			if err != nil {
+				panic(err)
+			}
+			total += len(blob)
+		}
+		fmt.Printf("%-10s AVG BYTES: %d, ENCODE: %v\n", codec.Name(), total/numProducts, time.Since(start)/numProducts)
+	}
+}
+
+func benchmarkProductBlobs(b *testing.B, fn func(codec Codec, data []byte)) {
+	p := randomProduct(10)
+	data, err := proto.Marshal(p.Product)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, codec := range allCodecs {
+		b.Run(codec.Name(), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				fn(codec, data)
+			}
+		})
+	}
+}
+
+func BenchmarkCodec_Encode(b *testing.B) {
+	benchmarkProductBlobs(b, func(codec Codec, data []byte) {
+		_, _ = encodeBlob(codec, data)
+	})
+}
+
+func BenchmarkCodec_Decode(b *testing.B) {
+	blobs := map[Codec][]byte{}
+	benchmarkProductBlobs(b, func(codec Codec, data []byte) {
+		blob, ok := blobs[codec]
+		if !ok {
+			blob, _ = encodeBlob(codec, data)
+			blobs[codec] = blob
+		}
+		_, _ = decodeBlob(blob)
+	})
+}
+
+func TestCodec__Memcache_Throughput(t *testing.T) {
+	rand.Seed(randSeed)
+
+	client, err := memcache.New(memcacheAddrs[0], 4)
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	const numProducts = 20000
+	const batchSize = 100
+
+	products := make([]Product, 0, numProducts)
+	for i := 0; i < numProducts; i++ {
+		products = append(products, randomProduct(i))
+	}
+
+	for codecIndex, codec := range allCodecs {
+		SetProductCodec(codec)
+
+		key := func(i int) string {
+			return fmt.Sprintf("codec:%d:%s", codecIndex, products[i].Sku)
+		}
+
+		totalBytes := 0
+		start := time.Now()
+		for k := 0; k < numProducts; k += batchSize {
+			p := client.Pipeline()
+			for i := k; i < k+batchSize; i++ {
+				data, err := products[i].Marshal()
+				if err != nil {
+					panic(err)
+				}
+				totalBytes += len(data)
+				p.MSet(key(i), data, memcache.MSetOptions{})
+			}
+			p.Finish()
+		}
+		writeDuration := time.Since(start)
+
+		start = time.Now()
+		for k := 0; k < numProducts; k += batchSize {
+			p := client.Pipeline()
+			fnList := make([]func() (memcache.MGetResponse, error), 0, batchSize)
+			for i := k; i < k+batchSize; i++ {
+				fnList = append(fnList, p.MGet(key(i), memcache.MGetOptions{}))
+			}
+			for _, fn := range fnList {
+				resp, err := fn()
+				if err != nil {
+					panic(err)
+				}
+				if _, err := unmarshalProduct(resp.Data); err != nil {
+					panic(err)
+				}
+			}
+			p.Finish()
+		}
+		readDuration := time.Since(start)
+
+		fmt.Println("=========================================")
+		fmt.Println("CODEC:", codec.Name())
+		fmt.Println("TOTAL BYTES:", totalBytes)
+		fmt.Println("WRITE QPS:", float64(numProducts)/writeDuration.Seconds())
+		fmt.Println("READ + DECODE QPS:", float64(numProducts)/readDuration.Seconds())
+	}
+
+	SetProductCodec(NoneCodec)
+}
@@ -1,2 +1,3 @@
 curl -X DELETE localhost:9400/bench_full_products
 curl -X DELETE localhost:9400/bench_products
+curl -X DELETE localhost:9400/bench_query_products
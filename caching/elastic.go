@@ -1,11 +1,13 @@
 package caching
 
 import (
+	"bench_elastic/pb"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
 	"io"
 	"net"
 	"net/http"
@@ -19,6 +21,11 @@ type ElasticClient struct {
 const fullProductIndex = "bench_full_products"
 const productIndex = "bench_products"
 
+// queryProductIndex is a copy of fullProductIndex with the name field indexed, for the query generators.
+// put_index.sh creates it empty, run reindex_query_index.sh after loading fullProductIndex
+// (TestElasticClient_IndexProducts) to copy the products. fullProductIndex keeps the mapping of the earlier benchmarks
+const queryProductIndex = "bench_query_products"
+
 const maxConnsPerHost = 20
 
 func NewElasticClient() *ElasticClient {
@@ -137,34 +144,160 @@ func (c *ElasticClient) IndexSimpleProducts(ctx context.Context, products []Simp
 	fmt.Println(string(body), err)
 }
 
-func (c *ElasticClient) Search(ctx context.Context, searchText string, index string) {
-	query := fmt.Sprintf(`
-{
-  "track_total_hits": false,
-  "from": 0,
-  "size": 30,
-  "query": {
-    "match": {
-	  "search_text": %q
-    }
-  }
+// SearchResult ...
+type SearchResult struct {
+	Status string
+	Bytes  int
 }
-`, searchText)
 
+func (c *ElasticClient) Search(ctx context.Context, searchText string, index string, opts SearchOptions) (SearchResult, error) {
+	return c.SearchWithQuery(ctx, matchSearchText(searchText), index, opts)
+}
+
+// SearchWithQuery is Search with an arbitrary query clause
+func (c *ElasticClient) SearchWithQuery(
+	ctx context.Context, query map[string]interface{}, index string, opts SearchOptions,
+) (SearchResult, error) {
 	var buf bytes.Buffer
-	buf.WriteString(query)
+	buf.WriteString(mustMarshalJSON(opts.body(query)))
+
 	resp, err := c.client.Search(
 		c.client.Search.WithBody(&buf),
 		c.client.Search.WithIndex(index),
 		c.client.Search.WithContext(ctx),
 	)
 	if err != nil {
-		panic(err)
+		return SearchResult{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if resp.IsError() {
+		return SearchResult{}, fmt.Errorf("search error: %s %s", resp.Status(), string(body))
+	}
+
+	return SearchResult{
+		Status: resp.Status(),
+		Bytes:  len(body),
+	}, nil
+}
+
+type searchHit struct {
+	ID     string              `json:"_id"`
+	Source json.RawMessage     `json:"_source"`
+	Fields map[string][]string `json:"fields"`
+	Sort   []interface{}       `json:"sort"`
+}
+
+type searchResponse struct {
+	PitID string `json:"pit_id"`
+	Hits  struct {
+		Hits []searchHit `json:"hits"`
+	} `json:"hits"`
+}
+
+// doSearch with an empty index is for searching with a point in time
+func (c *ElasticClient) doSearch(ctx context.Context, index string, query string) (searchResponse, error) {
+	var buf bytes.Buffer
+	buf.WriteString(query)
+
+	options := []func(*esapi.SearchRequest){
+		c.client.Search.WithBody(&buf),
+		c.client.Search.WithContext(ctx),
+	}
+	if len(index) > 0 {
+		options = append(options, c.client.Search.WithIndex(index))
+	}
+
+	resp, err := c.client.Search(options...)
+	if err != nil {
+		return searchResponse{}, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
 	body, err := io.ReadAll(resp.Body)
-	fmt.Println(resp.Status(), err, len(body))
+	if err != nil {
+		return searchResponse{}, err
+	}
+	if resp.IsError() {
+		return searchResponse{}, fmt.Errorf("search error: %s %s", resp.Status(), string(body))
+	}
+
+	var result searchResponse
+	err = json.Unmarshal(body, &result)
+	return result, err
+}
+
+// SearchSKUs searches the thin index and returns only the skus, read from doc values
+func (c *ElasticClient) SearchSKUs(ctx context.Context, searchText string, size int) ([]string, error) {
+	query := fmt.Sprintf(`
+{
+  "track_total_hits": false,
+  "from": 0,
+  "size": %d,
+  "query": {
+    "match": {
+	  "search_text": %q
+    }
+  },
+  "_source": false,
+  "stored_fields": "_none_",
+  "docvalue_fields": ["sku"]
+}
+`, size, searchText)
+
+	resp, err := c.doSearch(ctx, productIndex, query)
+	if err != nil {
+		return nil, err
+	}
+
+	skus := make([]string, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		values := hit.Fields["sku"]
+		if len(values) == 0 {
+			return nil, fmt.Errorf("missing sku doc value for document %q", hit.ID)
+		}
+		skus = append(skus, values[0])
+	}
+	return skus, nil
+}
+
+// SearchFullProducts searches the full index and decodes the products from _source
+func (c *ElasticClient) SearchFullProducts(ctx context.Context, searchText string, size int) ([]Product, error) {
+	query := fmt.Sprintf(`
+{
+  "track_total_hits": false,
+  "from": 0,
+  "size": %d,
+  "query": {
+    "match": {
+	  "search_text": %q
+    }
+  }
+}
+`, size, searchText)
+
+	resp, err := c.doSearch(ctx, fullProductIndex, query)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]Product, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		p := Product{
+			Product: &pb.Product{},
+		}
+		if err := json.Unmarshal(hit.Source, p.Product); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, nil
 }
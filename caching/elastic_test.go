@@ -10,9 +10,6 @@ import (
 	"time"
 )
 
-const numberOfProducts = 4000000
-const randSeed = 12348888
-
 func TestElasticClient_IndexProducts(t *testing.T) {
 	t.Run("setup index", func(t *testing.T) {
 		t.Skip()
@@ -65,16 +62,16 @@ func TestElasticClient_Search(t *testing.T) {
 		client := NewElasticClient()
 
 		start := time.Now()
-		client.Search(context.Background(), searchText, fullProductIndex)
-		fmt.Println(time.Since(start))
+		result, err := client.Search(context.Background(), searchText, fullProductIndex, DefaultSearchOptions())
+		fmt.Println(result, err, time.Since(start))
 	})
 
 	t.Run("search simple products", func(t *testing.T) {
 		client := NewElasticClient()
 
 		start := time.Now()
-		client.Search(context.Background(), searchText, productIndex)
-		fmt.Println(time.Since(start))
+		result, err := client.Search(context.Background(), searchText, productIndex, DefaultSearchOptions())
+		fmt.Println(result, err, time.Since(start))
 	})
 }
 
@@ -104,7 +101,10 @@ func TestElasticClient_Search_Alternate(t *testing.T) {
 				searchText := randomSentence(2, 3)
 
 				start := time.Now()
-				client.Search(context.Background(), searchText, productIndex)
+				_, err := client.Search(context.Background(), searchText, productIndex, DefaultSearchOptions())
+				if err != nil {
+					panic(err)
+				}
 				duration := time.Since(start)
 
 				simpleMut.Lock()
@@ -122,7 +122,10 @@ func TestElasticClient_Search_Alternate(t *testing.T) {
 				searchText := randomSentence(2, 4)
 
 				start := time.Now()
-				client.Search(context.Background(), searchText, fullProductIndex)
+				_, err := client.Search(context.Background(), searchText, fullProductIndex, DefaultSearchOptions())
+				if err != nil {
+					panic(err)
+				}
 				duration := time.Since(start)
 
 				fullMut.Lock()
@@ -0,0 +1,185 @@
+package caching
+
+import (
+	"bench_elastic/pb"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"math/rand"
+	"time"
+)
+
+// ProductEncoding serializes products, for comparing the formats of cached products
+type ProductEncoding interface {
+	Name() string
+	Encode(p *pb.Product) ([]byte, error)
+	Decode(data []byte) (*pb.Product, error)
+}
+
+type protoEncoding struct {
+}
+
+type protoJSONEncoding struct {
+}
+
+type jsonEncoding struct {
+}
+
+type compactEncoding struct {
+}
+
+var (
+	// ProtoEncoding is the binary protobuf, the format used by Product.Marshal
+	ProtoEncoding ProductEncoding = protoEncoding{}
+
+	// ProtoJSONEncoding is the canonical protobuf JSON mapping
+	ProtoJSONEncoding ProductEncoding = protoJSONEncoding{}
+
+	// JSONEncoding is encoding/json, the format used by ElasticClient.IndexProducts
+	JSONEncoding ProductEncoding = jsonEncoding{}
+
+	// CompactEncoding is a hand-written format of length prefixed fields in a fixed order
+	CompactEncoding ProductEncoding = compactEncoding{}
+)
+
+// ProductEncodings ...
+var ProductEncodings = []ProductEncoding{
+	ProtoEncoding,
+	ProtoJSONEncoding,
+	JSONEncoding,
+	CompactEncoding,
+}
+
+func (protoEncoding) Name() string {
+	return "proto"
+}
+
+func (protoEncoding) Encode(p *pb.Product) ([]byte, error) {
+	return proto.Marshal(p)
+}
+
+func (protoEncoding) Decode(data []byte) (*pb.Product, error) {
+	p := &pb.Product{}
+	err := proto.Unmarshal(data, p)
+	return p, err
+}
+
+func (protoJSONEncoding) Name() string {
+	return "protojson"
+}
+
+func (protoJSONEncoding) Encode(p *pb.Product) ([]byte, error) {
+	return protojson.Marshal(p)
+}
+
+func (protoJSONEncoding) Decode(data []byte) (*pb.Product, error) {
+	p := &pb.Product{}
+	err := protojson.Unmarshal(data, p)
+	return p, err
+}
+
+func (jsonEncoding) Name() string {
+	return "json"
+}
+
+func (jsonEncoding) Encode(p *pb.Product) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (jsonEncoding) Decode(data []byte) (*pb.Product, error) {
+	p := &pb.Product{}
+	err := json.Unmarshal(data, p)
+	return p, err
+}
+
+func (compactEncoding) Name() string {
+	return "compact"
+}
+
+func compactFields(p *pb.Product) []*string {
+	return []*string{
+		&p.Sku, &p.Name, &p.SearchText,
+		&p.Field1, &p.Field2, &p.Field3,
+		&p.Field4, &p.Field5, &p.Field6,
+		&p.Field7, &p.Field8, &p.Field9,
+	}
+}
+
+func (compactEncoding) Encode(p *pb.Product) ([]byte, error) {
+	fields := compactFields(p)
+
+	size := 0
+	for _, f := range fields {
+		size += binary.MaxVarintLen32 + len(*f)
+	}
+
+	data := make([]byte, 0, size)
+	for _, f := range fields {
+		data = binary.AppendUvarint(data, uint64(len(*f)))
+		data = append(data, *f...)
+	}
+	return data, nil
+}
+
+var errInvalidCompactData = errors.New("invalid compact product data")
+
+func (compactEncoding) Decode(data []byte) (*pb.Product, error) {
+	p := &pb.Product{}
+	for _, f := range compactFields(p) {
+		n, size := binary.Uvarint(data)
+		if size <= 0 || uint64(len(data)-size) < n {
+			return nil, errInvalidCompactData
+		}
+		data = data[size:]
+
+		*f = string(data[:n])
+		data = data[n:]
+	}
+
+	if len(data) > 0 {
+		return nil, errInvalidCompactData
+	}
+	return p, nil
+}
+
+// PrintEncodingReport prints the average size, encode and decode durations of every encoding,
+// over numProducts generated products
+func PrintEncodingReport(numProducts int) {
+	rand.Seed(randSeed)
+
+	products := make([]*pb.Product, 0, numProducts)
+	for i := 0; i < numProducts; i++ {
+		products = append(products, randomProduct(i).Product)
+	}
+
+	fmt.Printf("%-10s %10s %12s %12s\n", "ENCODING", "AVG BYTES", "ENCODE", "DECODE")
+	for _, enc := range ProductEncodings {
+		blobs := make([][]byte, 0, numProducts)
+		totalBytes := 0
+
+		start := time.Now()
+		for _, p := range products {
+			data, err := enc.Encode(p)
+			if err != nil {
+				panic(err)
+			}
+			blobs = append(blobs, data)
+			totalBytes += len(data)
+		}
+		encodeDuration := time.Since(start)
+
+		start = time.Now()
+		for _, data := range blobs {
+			if _, err := enc.Decode(data); err != nil {
+				panic(err)
+			}
+		}
+		decodeDuration := time.Since(start)
+
+		fmt.Printf("%-10s %10d %12v %12v\n", enc.Name(), totalBytes/numProducts,
+			encodeDuration/time.Duration(numProducts), decodeDuration/time.Duration(numProducts))
+	}
+}
@@ -0,0 +1,132 @@
+package caching
+
+import (
+	"bench_elastic/util"
+	"fmt"
+	"github.com/QuangTung97/go-memcache/memcache"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestProductEncodings__Round_Trip(t *testing.T) {
+	p := randomProduct(10)
+
+	for _, enc := range ProductEncodings {
+		t.Run(enc.Name(), func(t *testing.T) {
+			data, err := enc.Encode(p.Product)
+			assert.Equal(t, nil, err)
+
+			result, err := enc.Decode(data)
+			assert.Equal(t, nil, err)
+			assert.True(t, proto.Equal(p.Product, result))
+		})
+	}
+}
+
+func TestCompactEncoding__Invalid(t *testing.T) {
+	data, err := CompactEncoding.Encode(randomProduct(10).Product)
+	assert.Equal(t, nil, err)
+
+	_, err = CompactEncoding.Decode(data[:len(data)-1])
+	assert.Equal(t, errInvalidCompactData, err)
+
+	_, err = CompactEncoding.Decode(append(data, 'x'))
+	assert.Equal(t, errInvalidCompactData, err)
+}
+
+func TestPrintEncodingReport(t *testing.T) {
+	PrintEncodingReport(1000)
+}
+
+func BenchmarkProductEncoding_Encode(b *testing.B) {
+	p := randomProduct(10)
+
+	for _, enc := range ProductEncodings {
+		b.Run(enc.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+
+			var data []byte
+			for n := 0; n < b.N; n++ {
+				data, _ = enc.Encode(p.Product)
+			}
+			b.ReportMetric(float64(len(data)), "bytes")
+		})
+	}
+}
+
+func BenchmarkProductEncoding_Decode(b *testing.B) {
+	p := randomProduct(10)
+
+	for _, enc := range ProductEncodings {
+		data, err := enc.Encode(p.Product)
+		if err != nil {
+			panic(err)
+		}
+
+		b.Run(enc.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				_, _ = enc.Decode(data)
+			}
+		})
+	}
+}
+
+func TestProductEncodings__Memcache_Latency(t *testing.T) {
+	rand.Seed(randSeed)
+
+	client, err := memcache.New(memcacheAddrs[0], 4)
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	const numProducts = 20000
+	const batchSize = 40
+
+	products := make([]Product, 0, numProducts)
+	for i := 0; i < numProducts; i++ {
+		products = append(products, randomProduct(i))
+	}
+
+	for _, enc := range ProductEncodings {
+		key := func(i int) string {
+			return fmt.Sprintf("encoding:%s:%s", enc.Name(), products[i].Sku)
+		}
+
+		for k := 0; k < numProducts; k += batchSize {
+			p := client.Pipeline()
+			for i := k; i < k+batchSize; i++ {
+				data, err := enc.Encode(products[i].Product)
+				if err != nil {
+					panic(err)
+				}
+				p.MSet(key(i), data, memcache.MSetOptions{})
+			}
+			p.Finish()
+		}
+
+		fmt.Println("=========================================")
+		fmt.Println("ENCODING:", enc.Name())
+		util.BenchConcurrent(1000, 10, func() {
+			p := client.Pipeline()
+			defer p.Finish()
+
+			fnList := make([]func() (memcache.MGetResponse, error), 0, batchSize)
+			for m := 0; m < batchSize; m++ {
+				fnList = append(fnList, p.MGet(key(rand.Intn(numProducts)), memcache.MGetOptions{}))
+			}
+			for _, fn := range fnList {
+				resp, err := fn()
+				if err != nil {
+					panic(err)
+				}
+				if _, err := enc.Decode(resp.Data); err != nil {
+					panic(err)
+				}
+			}
+		})
+	}
+}
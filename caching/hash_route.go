@@ -0,0 +1,193 @@
+package caching
+
+import (
+	"bench_elastic/util"
+	"fmt"
+	"github.com/QuangTung97/memproxy/proxy"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+)
+
+// hashRoute routes keys to memcache servers by consistent hashing, hot keys are replicated
+type hashRoute struct {
+	ring *util.HashRing[proxy.ServerID]
+
+	hotKeys     map[string]struct{}
+	hotReplicas int
+
+	metrics map[proxy.ServerID]*nodeMetrics
+}
+
+type nodeMetrics struct {
+	selections atomic.Int64
+	deletes    atomic.Int64
+	failures   atomic.Int64
+}
+
+// NodeStats is a snapshot of the per server counters.
+// Selections counts the keys routed to the server for gets and sets, deletes are counted apart
+type NodeStats struct {
+	Selections int64
+	Deletes    int64
+	Failures   int64
+}
+
+type hashRouteSelector struct {
+	route  *hashRoute
+	failed map[proxy.ServerID]struct{}
+}
+
+var _ proxy.Route = &hashRoute{}
+
+func newHashRoute(
+	servers []proxy.SimpleServerConfig, numVirtualNodes int,
+	hotKeys []string, hotReplicas int,
+) *hashRoute {
+	ids := make([]proxy.ServerID, 0, len(servers))
+	names := map[proxy.ServerID]string{}
+	metrics := map[proxy.ServerID]*nodeMetrics{}
+
+	for _, s := range servers {
+		ids = append(ids, s.ID)
+		names[s.ID] = s.Address()
+		metrics[s.ID] = &nodeMetrics{}
+	}
+
+	hotKeySet := map[string]struct{}{}
+	for _, k := range hotKeys {
+		hotKeySet[k] = struct{}{}
+	}
+
+	return &hashRoute{
+		ring: util.NewHashRing(ids, numVirtualNodes, func(id proxy.ServerID) string {
+			return names[id]
+		}),
+
+		hotKeys:     hotKeySet,
+		hotReplicas: hotReplicas,
+
+		metrics: metrics,
+	}
+}
+
+// NewSelector ...
+func (r *hashRoute) NewSelector() proxy.Selector {
+	return &hashRouteSelector{
+		route: r,
+	}
+}
+
+func (r *hashRoute) replicasOf(key string) int {
+	if _, ok := r.hotKeys[key]; ok && r.hotReplicas > 1 {
+		return r.hotReplicas
+	}
+	return 1
+}
+
+func (r *hashRoute) nodeStats() map[proxy.ServerID]NodeStats {
+	result := make(map[proxy.ServerID]NodeStats, len(r.metrics))
+	for id, m := range r.metrics {
+		result[id] = NodeStats{
+			Selections: m.selections.Load(),
+			Deletes:    m.deletes.Load(),
+			Failures:   m.failures.Load(),
+		}
+	}
+	return result
+}
+
+// SetFailedServer ...
+func (s *hashRouteSelector) SetFailedServer(server proxy.ServerID) {
+	if s.failed == nil {
+		s.failed = map[proxy.ServerID]struct{}{}
+	}
+	if _, existed := s.failed[server]; !existed {
+		s.failed[server] = struct{}{}
+		s.route.metrics[server].failures.Add(1)
+	}
+}
+
+// HasNextAvailableServer ...
+func (s *hashRouteSelector) HasNextAvailableServer() bool {
+	return len(s.failed) < len(s.route.ring.Nodes())
+}
+
+func (r *hashRoute) hasFailed(id proxy.ServerID) bool {
+	return r.metrics[id].failures.Load() > 0
+}
+
+// SelectServer chooses the owner of the key, or a random replica for hot keys.
+// Failed servers are skipped in the order of the ring, walking only until enough servers are found
+func (s *hashRouteSelector) SelectServer(key string) proxy.ServerID {
+	n := s.route.replicasOf(key)
+
+	// a random one of the first n available servers, without collecting them
+	var id proxy.ServerID
+	found := 0
+	s.route.ring.Walk(key, func(node proxy.ServerID) bool {
+		if _, failed := s.failed[node]; failed {
+			return true
+		}
+		found++
+		if rand.Intn(found) == 0 {
+			id = node
+		}
+		return found < n
+	})
+
+	// all servers failed, the same as without failures
+	if found == 0 {
+		s.route.ring.Walk(key, func(node proxy.ServerID) bool {
+			found++
+			if rand.Intn(found) == 0 {
+				id = node
+			}
+			return found < n
+		})
+	}
+
+	s.route.metrics[id].selections.Add(1)
+	return id
+}
+
+// SelectForDelete returns all servers that could have served the key: the replicas and,
+// after failovers, the servers following them on the ring up to the n-th server that never failed.
+// Failures are the ones seen by this process
+func (s *hashRouteSelector) SelectForDelete(key string) []proxy.ServerID {
+	n := s.route.replicasOf(key)
+
+	var ids []proxy.ServerID
+	healthy := 0
+	s.route.ring.Walk(key, func(node proxy.ServerID) bool {
+		ids = append(ids, node)
+		if !s.route.hasFailed(node) {
+			healthy++
+		}
+		return healthy < n
+	})
+
+	for _, id := range ids {
+		s.route.metrics[id].deletes.Add(1)
+	}
+	return ids
+}
+
+// Reset does nothing, the selection of a key does not depend on previous selections
+func (*hashRouteSelector) Reset() {
+}
+
+func printNodeStats(stats map[proxy.ServerID]NodeStats) {
+	ids := make([]proxy.ServerID, 0, len(stats))
+	for id := range stats {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		s := stats[id]
+		fmt.Printf("NODE %d: SELECTIONS: %d, DELETES: %d, FAILURES: %d\n", id, s.Selections, s.Deletes, s.Failures)
+	}
+}
@@ -0,0 +1,92 @@
+package caching
+
+import (
+	"fmt"
+	"github.com/QuangTung97/memproxy/proxy"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newHashRouteTest(hotKeys ...string) *hashRoute {
+	return newHashRoute(parseServerConfigs(multiNodeMemcacheAddrs[:3]), 160, hotKeys, 2)
+}
+
+func TestHashRoute(t *testing.T) {
+	t.Run("same server for same key", func(t *testing.T) {
+		r := newHashRouteTest()
+		s := r.NewSelector()
+
+		id := s.SelectServer("SKU00000001")
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, id, s.SelectServer("SKU00000001"))
+		}
+		assert.Equal(t, int64(11), r.nodeStats()[id].Selections)
+	})
+
+	t.Run("failed server", func(t *testing.T) {
+		r := newHashRouteTest()
+		s := r.NewSelector()
+
+		id := s.SelectServer("SKU00000001")
+
+		s.SetFailedServer(id)
+		assert.Equal(t, true, s.HasNextAvailableServer())
+
+		next := s.SelectServer("SKU00000001")
+		assert.NotEqual(t, id, next)
+		assert.Equal(t, int64(1), r.nodeStats()[id].Failures)
+
+		// the failover server may hold a copy, also for the later selectors
+		assert.Equal(t, []proxy.ServerID{id, next}, s.SelectForDelete("SKU00000001"))
+		assert.Equal(t, []proxy.ServerID{id, next}, r.NewSelector().SelectForDelete("SKU00000001"))
+	})
+
+	t.Run("all servers failed", func(t *testing.T) {
+		r := newHashRouteTest()
+		s := r.NewSelector()
+
+		id := s.SelectServer("SKU00000001")
+		for _, server := range r.ring.Nodes() {
+			s.SetFailedServer(server)
+		}
+		assert.Equal(t, false, s.HasNextAvailableServer())
+		assert.Equal(t, id, s.SelectServer("SKU00000001"))
+	})
+
+	t.Run("select without allocation", func(t *testing.T) {
+		r := newHashRouteTest("SKU00000001")
+		s := r.NewSelector()
+
+		allocs := testing.AllocsPerRun(100, func() {
+			s.SelectServer("SKU00000001")
+			s.SelectServer("SKU00000002")
+		})
+		assert.Equal(t, 0.0, allocs)
+	})
+
+	t.Run("hot key replicated", func(t *testing.T) {
+		r := newHashRouteTest("SKU00000001")
+		s := r.NewSelector()
+
+		chosen := map[interface{}]struct{}{}
+		for i := 0; i < 100; i++ {
+			chosen[s.SelectServer("SKU00000001")] = struct{}{}
+		}
+		assert.Equal(t, 2, len(chosen))
+
+		assert.Equal(t, 2, len(s.SelectForDelete("SKU00000001")))
+		assert.Equal(t, 1, len(s.SelectForDelete("SKU00000002")))
+	})
+
+	t.Run("all keys distributed", func(t *testing.T) {
+		r := newHashRouteTest()
+		s := r.NewSelector()
+
+		for i := 0; i < 3000; i++ {
+			s.SelectServer(fmt.Sprintf("SKU%08d", i))
+		}
+		for _, stats := range r.nodeStats() {
+			assert.Greater(t, stats.Selections, int64(700))
+		}
+	})
+}
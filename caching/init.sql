@@ -1,7 +1,24 @@
-CREATE TABLE `products`
+CREATE TABLE IF NOT EXISTS `products`
 (
     `sku`          VARCHAR(100) NOT NULL PRIMARY KEY,
     `content_data` MEDIUMBLOB   NOT NULL,
+    `version`      BIGINT       NOT NULL DEFAULT 0,
     `created_at`   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
     `updated_at`   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
-);
\ No newline at end of file
+);
+
+CREATE TABLE IF NOT EXISTS `shops`
+(
+    `id`      BIGINT      NOT NULL PRIMARY KEY,
+    `lat`     DOUBLE      NOT NULL,
+    `lon`     DOUBLE      NOT NULL,
+    `geohash` VARCHAR(12) NOT NULL,
+    INDEX `idx_geohash` (`geohash`)
+);
+
+CREATE TABLE IF NOT EXISTS `shops_spatial`
+(
+    `id`       BIGINT NOT NULL PRIMARY KEY,
+    `location` POINT  NOT NULL SRID 4326,
+    SPATIAL INDEX `idx_location` (`location`)
+);
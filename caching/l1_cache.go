@@ -0,0 +1,105 @@
+package caching
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// l1Cache is an in-process, size bounded LRU cache in front of memcache, it is thread safe.
+// Entries expire after ttl, so values put by a reader racing with an invalidation are stale for at most ttl
+type l1Cache struct {
+	capacity int
+	ttl      time.Duration
+	nowFn    func() time.Time
+
+	mut     sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type l1Entry struct {
+	key       string
+	product   Product
+	expiredAt time.Time
+}
+
+func newL1Cache(capacity int, ttl time.Duration, nowFn func() time.Time) *l1Cache {
+	return &l1Cache{
+		capacity: capacity,
+		ttl:      ttl,
+		nowFn:    nowFn,
+
+		entries: make(map[string]*list.Element, capacity),
+		lru:     list.New(),
+	}
+}
+
+func (c *l1Cache) get(key string) (Product, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return Product{}, false
+	}
+
+	entry := elem.Value.(*l1Entry)
+	if !c.nowFn().Before(entry.expiredAt) {
+		c.removeElement(elem)
+		return Product{}, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry.product, true
+}
+
+func (c *l1Cache) put(key string, product Product) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	expiredAt := c.nowFn().Add(c.ttl)
+
+	elem, ok := c.entries[key]
+	if ok {
+		entry := elem.Value.(*l1Entry)
+		entry.product = product
+		entry.expiredAt = expiredAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&l1Entry{
+		key:       key,
+		product:   product,
+		expiredAt: expiredAt,
+	})
+
+	for c.lru.Len() > c.capacity {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *l1Cache) invalidate(keys []string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, key := range keys {
+		elem, ok := c.entries[key]
+		if ok {
+			c.removeElement(elem)
+		}
+	}
+}
+
+func (c *l1Cache) len() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.lru.Len()
+}
+
+func (c *l1Cache) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*l1Entry)
+	delete(c.entries, entry.key)
+}
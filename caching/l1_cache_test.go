@@ -0,0 +1,86 @@
+package caching
+
+import (
+	"bench_elastic/pb"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newL1CacheTest(capacity int) (*l1Cache, *time.Time) {
+	now := time.Date(2022, 11, 20, 10, 0, 0, 0, time.UTC)
+	return newL1Cache(capacity, 10*time.Second, func() time.Time {
+		return now
+	}), &now
+}
+
+func l1TestProduct(sku string) Product {
+	return Product{
+		Product: &pb.Product{Sku: sku},
+	}
+}
+
+func TestL1Cache(t *testing.T) {
+	t.Run("get after put", func(t *testing.T) {
+		c, _ := newL1CacheTest(3)
+
+		_, ok := c.get("SKU01")
+		assert.Equal(t, false, ok)
+
+		c.put("SKU01", l1TestProduct("SKU01"))
+
+		p, ok := c.get("SKU01")
+		assert.Equal(t, true, ok)
+		assert.Equal(t, "SKU01", p.Sku)
+	})
+
+	t.Run("evict least recently used", func(t *testing.T) {
+		c, _ := newL1CacheTest(2)
+
+		c.put("SKU01", l1TestProduct("SKU01"))
+		c.put("SKU02", l1TestProduct("SKU02"))
+
+		_, ok := c.get("SKU01")
+		assert.Equal(t, true, ok)
+
+		c.put("SKU03", l1TestProduct("SKU03"))
+		assert.Equal(t, 2, c.len())
+
+		_, ok = c.get("SKU02")
+		assert.Equal(t, false, ok)
+
+		_, ok = c.get("SKU01")
+		assert.Equal(t, true, ok)
+		_, ok = c.get("SKU03")
+		assert.Equal(t, true, ok)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		c, now := newL1CacheTest(2)
+
+		c.put("SKU01", l1TestProduct("SKU01"))
+
+		*now = now.Add(9 * time.Second)
+		_, ok := c.get("SKU01")
+		assert.Equal(t, true, ok)
+
+		*now = now.Add(1 * time.Second)
+		_, ok = c.get("SKU01")
+		assert.Equal(t, false, ok)
+		assert.Equal(t, 0, c.len())
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		c, _ := newL1CacheTest(3)
+
+		c.put("SKU01", l1TestProduct("SKU01"))
+		c.put("SKU02", l1TestProduct("SKU02"))
+
+		c.invalidate([]string{"SKU01", "SKU03"})
+
+		_, ok := c.get("SKU01")
+		assert.Equal(t, false, ok)
+		_, ok = c.get("SKU02")
+		assert.Equal(t, true, ok)
+	})
+}
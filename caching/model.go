@@ -3,16 +3,49 @@ package caching
 import (
 	"bench_elastic/pb"
 	"bufio"
+	"bytes"
+	_ "embed"
 	"fmt"
 	"github.com/golang/protobuf/proto"
 	"math/rand"
-	"os"
 	"strings"
 	"time"
 )
 
 type Product struct {
 	*pb.Product
+
+	notFound bool
+	err      error
+}
+
+// ProductNotFoundError is returned from CacheRepo.GetProduct when the sku does not exist in the database
+type ProductNotFoundError struct {
+	SKU string
+}
+
+func (e ProductNotFoundError) Error() string {
+	return fmt.Sprintf("product not found: %s", e.SKU)
+}
+
+// notFoundMarker is cached for skus that do not exist in the database.
+// A protobuf message can not start with a zero byte (field number 0 is invalid)
+var notFoundMarker = []byte{0}
+
+func notFoundProduct(sku string) Product {
+	return Product{
+		Product:  &pb.Product{Sku: sku},
+		notFound: true,
+	}
+}
+
+// corruptProduct carries a decode error for a single key through the multi get filler,
+// Marshal returns the error so that the key is not cached and the error is returned for that key only
+func corruptProduct(sku string, err error) Product {
+	return Product{
+		Product: &pb.Product{Sku: sku},
+		err:     fmt.Errorf("unmarshal product %s: %w", sku, err),
+	}
 }
 
 type SimpleProduct struct {
@@ -41,6 +74,7 @@ func (k ProductKey) String() string {
 type ProductContent struct {
 	SKU         string `db:"sku"`
 	ContentData []byte `db:"content_data"`
+	Version     int64  `db:"version"`
 
 	CreatedAt time.Time `db:"updated_at"`
 	UpdatedAt time.Time `db:"updated_at"`
@@ -51,15 +85,38 @@ func (p ProductContent) GetSKU() string {
 }
 
 func (p Product) Marshal() ([]byte, error) {
-	return proto.Marshal(p.Product)
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.notFound {
+		return notFoundMarker, nil
+	}
+
+	data, err := proto.Marshal(p.Product)
+	if err != nil {
+		return nil, err
+	}
+	return encodeBlob(productCodec, data)
 }
 
 func unmarshalProduct(data []byte) (Product, error) {
+	if bytes.Equal(data, notFoundMarker) {
+		return Product{
+			Product:  &pb.Product{},
+			notFound: true,
+		}, nil
+	}
+
+	data, err := decodeBlob(data)
+	if err != nil {
+		return Product{}, err
+	}
+
 	result := Product{
 		Product: &pb.Product{},
 	}
 
-	err := proto.Unmarshal(data, result.Product)
+	err = proto.Unmarshal(data, result.Product)
 	return result, err
 }
 
@@ -75,14 +132,17 @@ func ProductContentFromProduct(p Product) ProductContent {
 	}
 }
 
-func readAllWords() []string {
-	file, err := os.Open("./all_words.txt")
-	if err != nil {
-		panic(err)
-	}
-	defer func() { _ = file.Close() }()
+// numberOfProducts is the number of generated products in the indices and the database
+const numberOfProducts = 4000000
+
+// randSeed is the seed for generating products, the same products are loaded to the indices and the database
+const randSeed = 12348888
 
-	scanner := bufio.NewScanner(file)
+//go:embed all_words.txt
+var allWordsContent string
+
+func readAllWords() []string {
+	scanner := bufio.NewScanner(strings.NewReader(allWordsContent))
 
 	result := make([]string, 0, 200)
 	for scanner.Scan() {
@@ -1,6 +1,7 @@
 package caching
 
 import (
+	"bench_elastic/pb"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -15,3 +16,30 @@ func TestRandomProduct(t *testing.T) {
 	p := randomProduct(10)
 	fmt.Println(p)
 }
+
+func TestProduct_Marshal__Not_Found(t *testing.T) {
+	data, err := notFoundProduct("SKU001").Marshal()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, notFoundMarker, data)
+
+	p, err := unmarshalProduct(data)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, p.notFound)
+}
+
+func TestProduct_Marshal__Empty_Product_Is_Not_Marker(t *testing.T) {
+	data, err := Product{Product: &pb.Product{}}.Marshal()
+	assert.Equal(t, nil, err)
+
+	p, err := unmarshalProduct(data)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, p.notFound)
+}
+
+func TestProduct_Marshal__Corrupt(t *testing.T) {
+	_, err := unmarshalProduct([]byte{0xff, 0xff})
+	assert.NotEqual(t, nil, err)
+
+	_, err = corruptProduct("SKU001", err).Marshal()
+	assert.NotEqual(t, nil, err)
+}
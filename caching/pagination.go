@@ -0,0 +1,190 @@
+package caching
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// PaginationMode is the way of walking through result pages
+type PaginationMode string
+
+const (
+	// PaginationFromSize uses from + size, the cost grows with the page depth
+	PaginationFromSize PaginationMode = "from_size"
+
+	// PaginationSearchAfter sorts by score with sku as the tiebreaker, and continues after the last hit
+	PaginationSearchAfter PaginationMode = "search_after"
+
+	// PaginationPIT is search_after on a point in time, a consistent view of the index between pages
+	PaginationPIT PaginationMode = "pit"
+)
+
+// PaginationModes ...
+var PaginationModes = []PaginationMode{
+	PaginationFromSize,
+	PaginationSearchAfter,
+	PaginationPIT,
+}
+
+const pitKeepAlive = "1m"
+
+func mustMarshalJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func matchSearchText(searchText string) map[string]interface{} {
+	return map[string]interface{}{
+		"match": map[string]interface{}{
+			"search_text": searchText,
+		},
+	}
+}
+
+// SearchPageFrom returns the page at offset from
+func (c *ElasticClient) SearchPageFrom(
+	ctx context.Context, index string, searchText string, from int, size int,
+) (searchResponse, error) {
+	return c.doSearch(ctx, index, mustMarshalJSON(map[string]interface{}{
+		"track_total_hits": false,
+		"from":             from,
+		"size":             size,
+		"query":            matchSearchText(searchText),
+		"_source":          false,
+		"docvalue_fields":  []string{"sku"},
+	}))
+}
+
+// SearchPageAfter returns the page after the sort values of the last hit, after is nil for the first page.
+// An empty pitID searches the index directly
+func (c *ElasticClient) SearchPageAfter(
+	ctx context.Context, index string, pitID string,
+	searchText string, size int, after []interface{},
+) (searchResponse, error) {
+	body := map[string]interface{}{
+		"track_total_hits": false,
+		"size":             size,
+		"query":            matchSearchText(searchText),
+		"_source":          false,
+		"docvalue_fields":  []string{"sku"},
+		"sort": []interface{}{
+			map[string]string{"_score": "desc"},
+			map[string]string{"sku": "asc"},
+		},
+	}
+	if after != nil {
+		body["search_after"] = after
+	}
+	if len(pitID) > 0 {
+		body["pit"] = map[string]string{
+			"id":         pitID,
+			"keep_alive": pitKeepAlive,
+		}
+		index = ""
+	}
+	return c.doSearch(ctx, index, mustMarshalJSON(body))
+}
+
+// OpenPointInTime ...
+func (c *ElasticClient) OpenPointInTime(ctx context.Context, index string) (string, error) {
+	resp, err := c.client.OpenPointInTime(
+		[]string{index}, pitKeepAlive,
+		c.client.OpenPointInTime.WithContext(ctx),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.IsError() {
+		return "", fmt.Errorf("open point in time error: %s %s", resp.Status(), string(body))
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	err = json.Unmarshal(body, &result)
+	return result.ID, err
+}
+
+// ClosePointInTime ...
+func (c *ElasticClient) ClosePointInTime(ctx context.Context, pitID string) error {
+	resp, err := c.client.ClosePointInTime(
+		c.client.ClosePointInTime.WithBody(strings.NewReader(mustMarshalJSON(map[string]string{
+			"id": pitID,
+		}))),
+		c.client.ClosePointInTime.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.IsError() {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("close point in time error: %s %s", resp.Status(), string(body))
+	}
+	return nil
+}
+
+// WalkPages fetches numPages pages in order, observe is called with the page depth (from 0) and the page latency.
+// It stops early when a page is empty
+func (c *ElasticClient) WalkPages(
+	ctx context.Context, mode PaginationMode, index string,
+	searchText string, pageSize int, numPages int,
+	observe func(page int, d time.Duration),
+) error {
+	var pitID string
+	if mode == PaginationPIT {
+		id, err := c.OpenPointInTime(ctx, index)
+		if err != nil {
+			return err
+		}
+		pitID = id
+		defer func() { _ = c.ClosePointInTime(ctx, pitID) }()
+	}
+
+	var after []interface{}
+
+	for page := 0; page < numPages; page++ {
+		start := time.Now()
+
+		var resp searchResponse
+		var err error
+
+		switch mode {
+		case PaginationFromSize:
+			resp, err = c.SearchPageFrom(ctx, index, searchText, page*pageSize, pageSize)
+		case PaginationSearchAfter, PaginationPIT:
+			resp, err = c.SearchPageAfter(ctx, index, pitID, searchText, pageSize, after)
+		default:
+			return fmt.Errorf("invalid pagination mode: %s", mode)
+		}
+		if err != nil {
+			return err
+		}
+
+		observe(page, time.Since(start))
+
+		hits := resp.Hits.Hits
+		if len(hits) == 0 {
+			return nil
+		}
+		after = hits[len(hits)-1].Sort
+		if len(resp.PitID) > 0 {
+			pitID = resp.PitID
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package caching
+
+import (
+	"bench_elastic/util"
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestElasticClient_WalkPages(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	client := NewElasticClient()
+
+	const pageSize = 20
+	const numPages = 100
+	const numThreads = 10
+	const loops = 10
+
+	for _, index := range []string{productIndex, fullProductIndex} {
+		for _, mode := range PaginationModes {
+			var mut sync.Mutex
+			pageDurations := make([][]time.Duration, numPages)
+
+			var wg sync.WaitGroup
+			wg.Add(numThreads)
+
+			for th := 0; th < numThreads; th++ {
+				go func() {
+					defer wg.Done()
+
+					for i := 0; i < loops; i++ {
+						err := client.WalkPages(
+							context.Background(), mode, index,
+							randomSentence(2, 3), pageSize, numPages,
+							func(page int, d time.Duration) {
+								mut.Lock()
+								pageDurations[page] = append(pageDurations[page], d)
+								mut.Unlock()
+							},
+						)
+						if err != nil {
+							panic(err)
+						}
+					}
+				}()
+			}
+
+			wg.Wait()
+
+			fmt.Println("=========================================")
+			fmt.Println("INDEX:", index, "MODE:", mode)
+			for page := 0; page < numPages; page += 10 {
+				durations := pageDurations[page]
+				util.SortDurations(durations)
+				fmt.Printf("PAGE %3d OFFSET %5d: P50 %v P99 %v\n", page, page*pageSize,
+					util.Percentile(durations, 50), util.Percentile(durations, 99))
+			}
+		}
+	}
+}
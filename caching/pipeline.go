@@ -0,0 +1,58 @@
+package caching
+
+import (
+	"bytes"
+	"github.com/QuangTung97/memproxy"
+)
+
+// cachePipeline wraps the memproxy pipeline used by CacheRepo, stats is nil for the pipelines of the warmer
+type cachePipeline struct {
+	memproxy.Pipeline
+
+	options *cacheOptions
+	stats   *cacheStats
+}
+
+func newCachePipeline(pipe memproxy.Pipeline, options *cacheOptions, stats *cacheStats) memproxy.Pipeline {
+	return &cachePipeline{
+		Pipeline: pipe,
+		options:  options,
+		stats:    stats,
+	}
+}
+
+// LeaseGet counts memcache hits, misses, errors and rejected leases
+func (p *cachePipeline) LeaseGet(key string, options memproxy.LeaseGetOptions) func() (memproxy.LeaseGetResponse, error) {
+	fn := p.Pipeline.LeaseGet(key, options)
+	if p.stats == nil {
+		return fn
+	}
+	return func() (memproxy.LeaseGetResponse, error) {
+		resp, err := fn()
+		if err != nil {
+			p.stats.memcacheErrors.Add(1)
+			return resp, err
+		}
+
+		switch resp.Status {
+		case memproxy.LeaseGetStatusFound:
+			p.stats.memcacheHits.Add(1)
+		case memproxy.LeaseGetStatusLeaseGranted:
+			p.stats.memcacheMisses.Add(1)
+		case memproxy.LeaseGetStatusLeaseRejected:
+			p.stats.leaseRejected.Add(1)
+		default:
+		}
+		return resp, nil
+	}
+}
+
+// LeaseSet stores not found markers with their own TTL
+func (p *cachePipeline) LeaseSet(
+	key string, data []byte, cas uint64, options memproxy.LeaseSetOptions,
+) func() (memproxy.LeaseSetResponse, error) {
+	if bytes.Equal(data, notFoundMarker) {
+		options.TTL = p.options.notFoundTTL
+	}
+	return p.Pipeline.LeaseSet(key, data, cas, options)
+}
@@ -0,0 +1,89 @@
+package caching
+
+import (
+	"github.com/QuangTung97/memproxy"
+	"github.com/QuangTung97/memproxy/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCachePipeline_LeaseSet(t *testing.T) {
+	mock := &mocks.PipelineMock{
+		LeaseSetFunc: func(
+			key string, data []byte, cas uint64, options memproxy.LeaseSetOptions,
+		) func() (memproxy.LeaseSetResponse, error) {
+			return func() (memproxy.LeaseSetResponse, error) {
+				return memproxy.LeaseSetResponse{}, nil
+			}
+		},
+	}
+
+	pipe := newCachePipeline(mock, computeCacheOptions(nil), &cacheStats{})
+
+	pipe.LeaseSet("SKU001", []byte("data"), 11, memproxy.LeaseSetOptions{})
+	pipe.LeaseSet("SKU002", notFoundMarker, 12, memproxy.LeaseSetOptions{})
+
+	calls := mock.LeaseSetCalls()
+	assert.Equal(t, 2, len(calls))
+	assert.Equal(t, uint32(0), calls[0].Options.TTL)
+	assert.Equal(t, uint32(60), calls[1].Options.TTL)
+}
+
+func TestCachePipeline_LeaseGet(t *testing.T) {
+	statuses := []memproxy.LeaseGetStatus{
+		memproxy.LeaseGetStatusFound,
+		memproxy.LeaseGetStatusLeaseGranted,
+		memproxy.LeaseGetStatusFound,
+		memproxy.LeaseGetStatusLeaseRejected,
+	}
+
+	mock := &mocks.PipelineMock{
+		LeaseGetFunc: func(key string, options memproxy.LeaseGetOptions) func() (memproxy.LeaseGetResponse, error) {
+			status := statuses[0]
+			statuses = statuses[1:]
+			return func() (memproxy.LeaseGetResponse, error) {
+				return memproxy.LeaseGetResponse{Status: status}, nil
+			}
+		},
+	}
+
+	stats := &cacheStats{}
+	pipe := newCachePipeline(mock, computeCacheOptions(nil), stats)
+
+	for i := 0; i < 4; i++ {
+		_, _ = pipe.LeaseGet("SKU001", memproxy.LeaseGetOptions{})()
+	}
+
+	assert.Equal(t, CacheStats{
+		MemcacheHits:   2,
+		MemcacheMisses: 1,
+		LeaseRejected:  1,
+	}, stats.snapshot())
+}
+
+func TestCachePipeline__Without_Stats(t *testing.T) {
+	mock := &mocks.PipelineMock{
+		LeaseGetFunc: func(key string, options memproxy.LeaseGetOptions) func() (memproxy.LeaseGetResponse, error) {
+			return func() (memproxy.LeaseGetResponse, error) {
+				return memproxy.LeaseGetResponse{Status: memproxy.LeaseGetStatusLeaseGranted, CAS: 12}, nil
+			}
+		},
+		LeaseSetFunc: func(
+			key string, data []byte, cas uint64, options memproxy.LeaseSetOptions,
+		) func() (memproxy.LeaseSetResponse, error) {
+			return func() (memproxy.LeaseSetResponse, error) {
+				return memproxy.LeaseSetResponse{}, nil
+			}
+		},
+	}
+
+	pipe := newCachePipeline(mock, computeCacheOptions(nil), nil)
+
+	resp, err := pipe.LeaseGet("SKU001", memproxy.LeaseGetOptions{})()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(12), resp.CAS)
+
+	// the TTL policy still applies
+	pipe.LeaseSet("SKU001", notFoundMarker, 12, memproxy.LeaseSetOptions{})
+	assert.Equal(t, uint32(60), mock.LeaseSetCalls()[0].Options.TTL)
+}
@@ -1,2 +1,3 @@
 curl -X PUT -H "Content-type: application/json" localhost:9400/bench_full_products -d @./mappings.json
 curl -X PUT -H "Content-type: application/json" localhost:9400/bench_products -d @./min_mappings.json
+curl -X PUT -H "Content-type: application/json" localhost:9400/bench_query_products -d @./query_mappings.json
@@ -0,0 +1,408 @@
+package caching
+
+import (
+	"bench_elastic/util"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// QueryGenerator builds a full-text query clause from the selected terms
+type QueryGenerator interface {
+	Name() string
+	Query(terms []string) map[string]interface{}
+}
+
+type matchQuery struct {
+}
+
+type multiMatchQuery struct {
+}
+
+type matchPhraseQuery struct {
+}
+
+type fuzzyQuery struct {
+}
+
+type boolShouldQuery struct {
+}
+
+var (
+	// MatchQuery is the original query of ElasticClient.Search
+	MatchQuery QueryGenerator = matchQuery{}
+
+	// MultiMatchQuery searches name and search_text, only indexed in queryProductIndex
+	MultiMatchQuery QueryGenerator = multiMatchQuery{}
+
+	// MatchPhraseQuery with slop, random terms rarely form a phrase, so this mostly measures the positions check
+	MatchPhraseQuery QueryGenerator = matchPhraseQuery{}
+
+	// FuzzyQuery injects a typo into every term and matches with fuzziness AUTO
+	FuzzyQuery QueryGenerator = fuzzyQuery{}
+
+	// BoolShouldQuery is one boosted should clause per term and one on name, with minimum_should_match
+	BoolShouldQuery QueryGenerator = boolShouldQuery{}
+)
+
+// QueryGenerators ...
+var QueryGenerators = []QueryGenerator{
+	MatchQuery,
+	MultiMatchQuery,
+	MatchPhraseQuery,
+	FuzzyQuery,
+	BoolShouldQuery,
+}
+
+func (matchQuery) Name() string {
+	return "match"
+}
+
+func (matchQuery) Query(terms []string) map[string]interface{} {
+	return matchSearchText(strings.Join(terms, " "))
+}
+
+func (multiMatchQuery) Name() string {
+	return "multi_match"
+}
+
+func (multiMatchQuery) Query(terms []string) map[string]interface{} {
+	return map[string]interface{}{
+		"multi_match": map[string]interface{}{
+			"query":  strings.Join(terms, " "),
+			"fields": []string{"name^2", "search_text"},
+			"type":   "best_fields",
+		},
+	}
+}
+
+func (matchPhraseQuery) Name() string {
+	return "match_phrase"
+}
+
+func (matchPhraseQuery) Query(terms []string) map[string]interface{} {
+	return map[string]interface{}{
+		"match_phrase": map[string]interface{}{
+			"search_text": map[string]interface{}{
+				"query": strings.Join(terms, " "),
+				"slop":  2,
+			},
+		},
+	}
+}
+
+func (fuzzyQuery) Name() string {
+	return "fuzzy"
+}
+
+// injectTypo replaces one character of words longer than 4 characters, deterministic for a word
+func injectTypo(word string) string {
+	if len(word) <= 4 {
+		return word
+	}
+	b := []byte(word)
+	i := len(b) / 2
+	if b[i] == 'x' {
+		b[i] = 'z'
+	} else {
+		b[i] = 'x'
+	}
+	return string(b)
+}
+
+func (fuzzyQuery) Query(terms []string) map[string]interface{} {
+	typos := make([]string, 0, len(terms))
+	for _, t := range terms {
+		typos = append(typos, injectTypo(t))
+	}
+
+	return map[string]interface{}{
+		"match": map[string]interface{}{
+			"search_text": map[string]interface{}{
+				"query":     strings.Join(typos, " "),
+				"fuzziness": "AUTO",
+			},
+		},
+	}
+}
+
+func (boolShouldQuery) Name() string {
+	return "bool_should"
+}
+
+func (boolShouldQuery) Query(terms []string) map[string]interface{} {
+	should := make([]interface{}, 0, len(terms)+1)
+	for i, t := range terms {
+		should = append(should, map[string]interface{}{
+			"match": map[string]interface{}{
+				"search_text": map[string]interface{}{
+					"query": t,
+					// earlier terms are more important
+					"boost": float64(len(terms) - i),
+				},
+			},
+		})
+	}
+	should = append(should, map[string]interface{}{
+		"match": map[string]interface{}{
+			"name": map[string]interface{}{
+				"query": strings.Join(terms, " "),
+				"boost": 2,
+			},
+		},
+	})
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": "50%",
+		},
+	}
+}
+
+// TermClass is the selectivity of the terms of a query
+type TermClass string
+
+const (
+	// TermClassCommon terms have the highest document frequencies, the least selective
+	TermClassCommon TermClass = "common"
+
+	// TermClassRare terms have the lowest document frequencies, the most selective
+	TermClassRare TermClass = "rare"
+
+	// TermClassMixed is one common term, the others are rare
+	TermClassMixed TermClass = "mixed"
+)
+
+// TermClasses ...
+var TermClasses = []TermClass{
+	TermClassCommon,
+	TermClassRare,
+	TermClassMixed,
+}
+
+// TermFrequencies is the document frequency of words in the search_text field
+type TermFrequencies struct {
+	docFreq map[string]int64
+
+	// words is sorted by decreasing document frequency
+	words []string
+}
+
+func NewTermFrequencies(docFreq map[string]int64) *TermFrequencies {
+	words := make([]string, 0, len(docFreq))
+	for w := range docFreq {
+		words = append(words, w)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		a, b := docFreq[words[i]], docFreq[words[j]]
+		if a != b {
+			return a > b
+		}
+		return words[i] < words[j]
+	})
+
+	return &TermFrequencies{
+		docFreq: docFreq,
+		words:   words,
+	}
+}
+
+// DocFreq returns 0 for unknown words
+func (f *TermFrequencies) DocFreq(word string) int64 {
+	return f.docFreq[word]
+}
+
+// SumDocFreq is the number of postings the terms read, the main cost of a disjunction
+func (f *TermFrequencies) SumDocFreq(terms []string) int64 {
+	var sum int64
+	for _, t := range terms {
+		sum += f.docFreq[t]
+	}
+	return sum
+}
+
+// TermSelector picks terms by class, it is NOT thread safe
+type TermSelector struct {
+	common []string
+	rare   []string
+	rand   *rand.Rand
+}
+
+// Selector uses the top fraction of the words as common terms, the bottom fraction as rare terms
+func (f *TermFrequencies) Selector(fraction float64, seed int64) *TermSelector {
+	n := int(fraction * float64(len(f.words)))
+	if n < 1 {
+		n = 1
+	}
+	return &TermSelector{
+		common: f.words[:n],
+		rare:   f.words[len(f.words)-n:],
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (s *TermSelector) pick(words []string) string {
+	return words[s.rand.Intn(len(words))]
+}
+
+// Terms returns n terms of the class
+func (s *TermSelector) Terms(class TermClass, n int) []string {
+	terms := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		switch {
+		case class == TermClassCommon:
+			terms = append(terms, s.pick(s.common))
+		case class == TermClassMixed && i == 0:
+			terms = append(terms, s.pick(s.common))
+		default:
+			terms = append(terms, s.pick(s.rare))
+		}
+	}
+	return terms
+}
+
+// LoadTermFrequencies reads document frequencies of the search_text terms from the term vectors of sampleDocs products
+func (c *ElasticClient) LoadTermFrequencies(ctx context.Context, index string, sampleDocs int) (*TermFrequencies, error) {
+	docFreq := map[string]int64{}
+
+	for i := 0; i < sampleDocs; i++ {
+		id := fmt.Sprintf("SKU%08d", rand.Intn(numberOfProducts))
+
+		resp, err := c.client.Termvectors(index,
+			c.client.Termvectors.WithContext(ctx),
+			c.client.Termvectors.WithDocumentID(id),
+			c.client.Termvectors.WithFields("search_text"),
+			c.client.Termvectors.WithTermStatistics(true),
+			c.client.Termvectors.WithFieldStatistics(false),
+			c.client.Termvectors.WithPositions(false),
+			c.client.Termvectors.WithOffsets(false),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.IsError() {
+			return nil, fmt.Errorf("term vectors error: %s %s", resp.Status(), string(body))
+		}
+
+		var result struct {
+			TermVectors map[string]struct {
+				Terms map[string]struct {
+					DocFreq int64 `json:"doc_freq"`
+				} `json:"terms"`
+			} `json:"term_vectors"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+
+		for term, stats := range result.TermVectors["search_text"].Terms {
+			docFreq[term] = stats.DocFreq
+		}
+	}
+
+	return NewTermFrequencies(docFreq), nil
+}
+
+// SlowQuery is one of the slowest queries of a QueryBenchRow
+type SlowQuery struct {
+	Terms      []string
+	SumDocFreq int64
+	Duration   time.Duration
+}
+
+// QueryBenchRow is the result of one generator with one term class
+type QueryBenchRow struct {
+	Generator string
+	Class     TermClass
+	Result    util.BenchResult
+	Slowest   []SlowQuery
+}
+
+// RunQueryBenchmark runs every generator with every term class, numTerms terms per query
+func RunQueryBenchmark(
+	c *ElasticClient, index string, freq *TermFrequencies, selector *TermSelector,
+	numTerms int, requestsPerThread int, numThreads int, numSlowest int,
+) []QueryBenchRow {
+	var rows []QueryBenchRow
+	for _, gen := range QueryGenerators {
+		for _, class := range TermClasses {
+			var mut sync.Mutex
+			var slow []SlowQuery
+
+			result := util.RunConcurrent(requestsPerThread, numThreads, func() {
+				mut.Lock()
+				terms := selector.Terms(class, numTerms)
+				mut.Unlock()
+
+				start := time.Now()
+				_, err := c.SearchWithQuery(context.Background(), gen.Query(terms), index, DefaultSearchOptions())
+				if err != nil {
+					panic(err)
+				}
+				d := time.Since(start)
+
+				mut.Lock()
+				slow = append(slow, SlowQuery{
+					Terms:      terms,
+					SumDocFreq: freq.SumDocFreq(terms),
+					Duration:   d,
+				})
+				mut.Unlock()
+			})
+
+			sort.Slice(slow, func(i, j int) bool {
+				return slow[i].Duration > slow[j].Duration
+			})
+			if len(slow) > numSlowest {
+				slow = slow[:numSlowest]
+			}
+
+			rows = append(rows, QueryBenchRow{
+				Generator: gen.Name(),
+				Class:     class,
+				Result:    result,
+				Slowest:   slow,
+			})
+		}
+	}
+	return rows
+}
+
+// PrintQueryBenchmark prints the latency table then the slowest queries of each row
+func PrintQueryBenchmark(rows []QueryBenchRow) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	_, _ = fmt.Fprintln(w, "QUERY\tTERMS\tP50\tP90\tP99\tQPS\t")
+	for _, row := range rows {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%v\t%.1f\t\n",
+			row.Generator, row.Class,
+			row.Result.Percentile(50).Round(time.Microsecond),
+			row.Result.Percentile(90).Round(time.Microsecond),
+			row.Result.Percentile(99).Round(time.Microsecond),
+			row.Result.QPS(),
+		)
+	}
+	_ = w.Flush()
+
+	for _, row := range rows {
+		fmt.Printf("SLOWEST %s / %s:\n", row.Generator, row.Class)
+		for _, q := range row.Slowest {
+			fmt.Printf("  %v doc_freq=%d %q\n", q.Duration.Round(time.Microsecond), q.SumDocFreq, strings.Join(q.Terms, " "))
+		}
+	}
+}
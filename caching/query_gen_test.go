@@ -0,0 +1,70 @@
+package caching
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQueryGenerators__Body(t *testing.T) {
+	terms := []string{"apple", "tree"}
+
+	assert.Equal(t,
+		`{"match":{"search_text":"apple tree"}}`,
+		mustMarshalJSON(MatchQuery.Query(terms)),
+	)
+	assert.Equal(t,
+		`{"multi_match":{"fields":["name^2","search_text"],"query":"apple tree","type":"best_fields"}}`,
+		mustMarshalJSON(MultiMatchQuery.Query(terms)),
+	)
+	assert.Equal(t,
+		`{"match_phrase":{"search_text":{"query":"apple tree","slop":2}}}`,
+		mustMarshalJSON(MatchPhraseQuery.Query(terms)),
+	)
+	assert.Equal(t,
+		`{"match":{"search_text":{"fuzziness":"AUTO","query":"apxle tree"}}}`,
+		mustMarshalJSON(FuzzyQuery.Query(terms)),
+	)
+	assert.Equal(t,
+		`{"bool":{"minimum_should_match":"50%","should":[`+
+			`{"match":{"search_text":{"boost":2,"query":"apple"}}},`+
+			`{"match":{"search_text":{"boost":1,"query":"tree"}}},`+
+			`{"match":{"name":{"boost":2,"query":"apple tree"}}}]}}`,
+		mustMarshalJSON(BoolShouldQuery.Query(terms)),
+	)
+}
+
+func TestTermSelector(t *testing.T) {
+	freq := NewTermFrequencies(map[string]int64{
+		"a": 100, "b": 90, "c": 50, "d": 10, "e": 2, "f": 1,
+	})
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, freq.words)
+	assert.Equal(t, int64(101), freq.SumDocFreq([]string{"a", "f", "unknown"}))
+
+	s := freq.Selector(0.34, 1)
+
+	for _, w := range s.Terms(TermClassCommon, 10) {
+		assert.Contains(t, []string{"a", "b"}, w)
+	}
+	for _, w := range s.Terms(TermClassRare, 10) {
+		assert.Contains(t, []string{"e", "f"}, w)
+	}
+
+	mixed := s.Terms(TermClassMixed, 3)
+	assert.Contains(t, []string{"a", "b"}, mixed[0])
+	for _, w := range mixed[1:] {
+		assert.Contains(t, []string{"e", "f"}, w)
+	}
+}
+
+func TestRunQueryBenchmark(t *testing.T) {
+	client := NewElasticClient()
+
+	freq, err := client.LoadTermFrequencies(context.Background(), queryProductIndex, 200)
+	if err != nil {
+		panic(err)
+	}
+
+	rows := RunQueryBenchmark(client, queryProductIndex, freq, freq.Selector(0.05, randSeed), 3, 20, 10, 3)
+	PrintQueryBenchmark(rows)
+}
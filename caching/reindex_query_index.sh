@@ -0,0 +1 @@
+curl -X POST -H "Content-type: application/json" "localhost:9400/_reindex?wait_for_completion=true" -d '{"source":{"index":"bench_full_products"},"dest":{"index":"bench_query_products"}}'
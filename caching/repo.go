@@ -30,7 +30,7 @@ VALUES (:sku, :content_data)
 }
 
 func (r *Repository) GetProducts(ctx context.Context, skus []string) ([]ProductContent, error) {
-	query, args, err := sqlx.In(`SELECT sku, content_data FROM products WHERE sku IN (?)`, skus)
+	query, args, err := sqlx.In(`SELECT sku, content_data, version FROM products WHERE sku IN (?)`, skus)
 	if err != nil {
 		return nil, err
 	}
@@ -39,3 +39,45 @@ func (r *Repository) GetProducts(ctx context.Context, skus []string) ([]ProductC
 	err = r.db.SelectContext(ctx, &result, query, args...)
 	return result, err
 }
+
+// ScanProducts returns at most limit products with sku > afterSKU, in sku order
+func (r *Repository) ScanProducts(ctx context.Context, afterSKU string, limit int) ([]ProductContent, error) {
+	query := `
+SELECT sku, content_data, version FROM products
+WHERE sku > ? ORDER BY sku LIMIT ?
+`
+	var result []ProductContent
+	err := r.db.SelectContext(ctx, &result, query, afterSKU, limit)
+	return result, err
+}
+
+// UpdateProducts updates content of existing products and bumps their versions
+func (r *Repository) UpdateProducts(ctx context.Context, products []ProductContent) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+UPDATE products SET content_data = ?, version = version + 1
+WHERE sku = ?
+`
+	for _, p := range products {
+		_, err := tx.ExecContext(ctx, query, p.ContentData, p.SKU)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) DeleteProducts(ctx context.Context, skus []string) error {
+	query, args, err := sqlx.In(`DELETE FROM products WHERE sku IN (?)`, skus)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, query, args...)
+	return err
+}
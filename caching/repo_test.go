@@ -4,7 +4,6 @@ import (
 	"bench_elastic/pb"
 	"context"
 	"github.com/stretchr/testify/assert"
-	"math/rand"
 	"testing"
 )
 
@@ -25,26 +24,16 @@ func TestRepo(t *testing.T) {
 
 func TestRepo__Insert_Data(t *testing.T) {
 	t.Run("setup database", func(t *testing.T) {
-		rand.Seed(randSeed)
-
 		db := NewDB()
-		rp := NewRepository(db)
-
-		for k := 0; k < numberOfProducts; {
-			const batchSize = 1000
 
-			batch := make([]Product, 0, batchSize)
-			for i := 0; i < batchSize; i++ {
-				batch = append(batch, randomProduct(k))
-				k++
-			}
+		err := ApplySchema(context.Background(), db)
+		if err != nil {
+			panic(err)
+		}
 
-			err := rp.InsertProducts(context.Background(), mapSlice(batch, func(x Product) ProductContent {
-				return ProductContentFromProduct(x)
-			}))
-			if err != nil {
-				panic(err)
-			}
+		err = SeedProducts(context.Background(), NewRepository(db), numberOfProducts, 1000, 8)
+		if err != nil {
+			panic(err)
 		}
 	})
 }
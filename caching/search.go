@@ -0,0 +1,55 @@
+package caching
+
+import (
+	"context"
+	"errors"
+)
+
+// ProductSearcher searches the thin index for skus, then hydrates products through the cache
+type ProductSearcher struct {
+	es    *ElasticClient
+	cache *CacheRepoFactory
+}
+
+func NewProductSearcher(es *ElasticClient, cache *CacheRepoFactory) *ProductSearcher {
+	return &ProductSearcher{
+		es:    es,
+		cache: cache,
+	}
+}
+
+// Search returns products in the order of the search hits, all products are fetched in one memproxy pipeline.
+// Skus deleted from the database after being indexed are skipped
+func (s *ProductSearcher) Search(ctx context.Context, searchText string, size int) ([]Product, error) {
+	skus, err := s.es.SearchSKUs(ctx, searchText, size)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := s.cache.NewRepo()
+	defer repo.Finish()
+
+	fnList := make([]func() (Product, error), 0, len(skus))
+	for _, sku := range skus {
+		fnList = append(fnList, repo.GetProduct(ctx, sku))
+	}
+
+	result := make([]Product, 0, len(fnList))
+	for _, fn := range fnList {
+		product, err := fn()
+		var notFoundErr ProductNotFoundError
+		if errors.As(err, &notFoundErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, product)
+	}
+	return result, nil
+}
+
+// SearchFull returns products directly from _source of the full index, for comparison
+func (s *ProductSearcher) SearchFull(ctx context.Context, searchText string, size int) ([]Product, error) {
+	return s.es.SearchFullProducts(ctx, searchText, size)
+}
@@ -0,0 +1,178 @@
+package caching
+
+import (
+	"bench_elastic/util"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// SearchOptions are the request body options of ElasticClient.Search
+type SearchOptions struct {
+	// TrackTotalHits is false, true or the number of hits to count accurately
+	TrackTotalHits interface{}
+
+	From int
+	Size int
+
+	// Source is true, false or the list of included fields
+	Source interface{}
+
+	// StoredFields is not sent when nil, []string{"_none_"} disables stored fields and metadata
+	StoredFields []string
+
+	DocValueFields []string
+}
+
+// DefaultSearchOptions is the request used by the original full vs simple experiments
+func DefaultSearchOptions() SearchOptions {
+	return SearchOptions{
+		TrackTotalHits: false,
+		From:           0,
+		Size:           30,
+		Source:         true,
+	}
+}
+
+func (o SearchOptions) body(query map[string]interface{}) map[string]interface{} {
+	body := map[string]interface{}{
+		"track_total_hits": o.TrackTotalHits,
+		"from":             o.From,
+		"size":             o.Size,
+		"query":            query,
+		"_source":          o.Source,
+	}
+	if o.StoredFields != nil {
+		body["stored_fields"] = o.StoredFields
+	}
+	if len(o.DocValueFields) > 0 {
+		body["docvalue_fields"] = o.DocValueFields
+	}
+	return body
+}
+
+func (o SearchOptions) valid() bool {
+	disabled := len(o.StoredFields) == 1 && o.StoredFields[0] == "_none_"
+	if disabled && o.Source != false {
+		// elasticsearch rejects: [stored_fields] cannot be disabled if [_source] is requested
+		return false
+	}
+	return true
+}
+
+func formatListOption(list []string) string {
+	if list == nil {
+		return "-"
+	}
+	return strings.Join(list, ",")
+}
+
+func formatSourceOption(source interface{}) string {
+	if list, ok := source.([]string); ok {
+		return formatListOption(list)
+	}
+	return fmt.Sprint(source)
+}
+
+// SearchMatrix is the values of each option, the runner executes every combination
+type SearchMatrix struct {
+	TrackTotalHits []interface{}
+	Sizes          []int
+	Sources        []interface{}
+	StoredFields   [][]string
+	DocValueFields [][]string
+}
+
+// DefaultSearchMatrix ...
+func DefaultSearchMatrix() SearchMatrix {
+	return SearchMatrix{
+		TrackTotalHits: []interface{}{false, true, 10000},
+		Sizes:          []int{10, 30, 100},
+		Sources:        []interface{}{true, false, []string{"sku", "name"}},
+		StoredFields:   [][]string{nil, {"_none_"}},
+		DocValueFields: [][]string{nil, {"sku"}},
+	}
+}
+
+// Options returns all valid combinations
+func (m SearchMatrix) Options() []SearchOptions {
+	var result []SearchOptions
+	for _, trackTotalHits := range m.TrackTotalHits {
+		for _, size := range m.Sizes {
+			for _, source := range m.Sources {
+				for _, storedFields := range m.StoredFields {
+					for _, docValueFields := range m.DocValueFields {
+						opts := SearchOptions{
+							TrackTotalHits: trackTotalHits,
+							Size:           size,
+							Source:         source,
+							StoredFields:   storedFields,
+							DocValueFields: docValueFields,
+						}
+						if opts.valid() {
+							result = append(result, opts)
+						}
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// SearchMatrixRow is the result of one combination
+type SearchMatrixRow struct {
+	Options  SearchOptions
+	Result   util.BenchResult
+	AvgBytes int64
+}
+
+// RunSearchMatrix runs every combination of the matrix with the same load, search text is generated per request
+func RunSearchMatrix(
+	c *ElasticClient, index string, matrix SearchMatrix,
+	requestsPerThread int, numThreads int,
+	searchText func() string,
+) []SearchMatrixRow {
+	var rows []SearchMatrixRow
+	for _, opts := range matrix.Options() {
+		var totalBytes atomic.Int64
+
+		result := util.RunConcurrent(requestsPerThread, numThreads, func() {
+			resp, err := c.Search(context.Background(), searchText(), index, opts)
+			if err != nil {
+				panic(err)
+			}
+			totalBytes.Add(int64(resp.Bytes))
+		})
+
+		rows = append(rows, SearchMatrixRow{
+			Options:  opts,
+			Result:   result,
+			AvgBytes: totalBytes.Load() / int64(result.Requests),
+		})
+	}
+	return rows
+}
+
+// PrintSearchMatrix prints one comparison table
+func PrintSearchMatrix(rows []SearchMatrixRow) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	_, _ = fmt.Fprintln(w, "TRACK_TOTAL_HITS\tSIZE\t_SOURCE\tSTORED_FIELDS\tDOCVALUE_FIELDS\tP50\tP90\tP99\tQPS\tAVG BYTES\t")
+	for _, row := range rows {
+		opts := row.Options
+		_, _ = fmt.Fprintf(w, "%v\t%d\t%s\t%s\t%s\t%v\t%v\t%v\t%.1f\t%d\t\n",
+			opts.TrackTotalHits, opts.Size, formatSourceOption(opts.Source),
+			formatListOption(opts.StoredFields), formatListOption(opts.DocValueFields),
+			row.Result.Percentile(50).Round(time.Microsecond),
+			row.Result.Percentile(90).Round(time.Microsecond),
+			row.Result.Percentile(99).Round(time.Microsecond),
+			row.Result.QPS(), row.AvgBytes,
+		)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,59 @@
+package caching
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSearchOptions_Body(t *testing.T) {
+	body := mustMarshalJSON(DefaultSearchOptions().body(matchSearchText("hello world")))
+	assert.Equal(t,
+		`{"_source":true,"from":0,"query":{"match":{"search_text":"hello world"}},"size":30,"track_total_hits":false}`,
+		body,
+	)
+
+	opts := SearchOptions{
+		TrackTotalHits: 10000,
+		Size:           20,
+		Source:         false,
+		StoredFields:   []string{"_none_"},
+		DocValueFields: []string{"sku"},
+	}
+	assert.Equal(t,
+		`{"_source":false,"docvalue_fields":["sku"],"from":0,`+
+			`"query":{"match":{"search_text":"hello"}},"size":20,"stored_fields":["_none_"],"track_total_hits":10000}`,
+		mustMarshalJSON(opts.body(matchSearchText("hello"))),
+	)
+}
+
+func TestSearchMatrix_Options(t *testing.T) {
+	options := DefaultSearchMatrix().Options()
+
+	// stored_fields = _none_ is only valid with _source = false
+	assert.Equal(t, 3*3*(3+1)*2, len(options))
+
+	for _, opts := range options {
+		if opts.StoredFields != nil {
+			assert.Equal(t, false, opts.Source)
+		}
+	}
+}
+
+func TestRunSearchMatrix(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	client := NewElasticClient()
+
+	for _, index := range []string{productIndex, fullProductIndex} {
+		fmt.Println("=========================================")
+		fmt.Println("INDEX:", index)
+
+		rows := RunSearchMatrix(client, index, DefaultSearchMatrix(), 20, 10, func() string {
+			return randomSentence(2, 3)
+		})
+		PrintSearchMatrix(rows)
+	}
+}
@@ -0,0 +1,59 @@
+package caching
+
+import (
+	"bench_elastic/util"
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+const searchSize = 30
+
+func TestProductSearcher_Search(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	f := NewCacheFactory(memcacheAddrs, NewDB())
+	defer func() { _ = f.Close() }()
+
+	s := NewProductSearcher(NewElasticClient(), f)
+
+	start := time.Now()
+	products, err := s.Search(context.Background(), randomSentence(2, 3), searchSize)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(len(products), time.Since(start))
+}
+
+func TestProductSearcher__Compare_With_Full_Source(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+
+	f := NewCacheFactory(memcacheAddrs, NewDB())
+	defer func() { _ = f.Close() }()
+
+	s := NewProductSearcher(NewElasticClient(), f)
+
+	const loops = 200
+	const numThreads = 10
+
+	fmt.Println("=========================================")
+	fmt.Println("SEARCH SKUS + HYDRATE FROM CACHE")
+	util.BenchConcurrent(loops, numThreads, func() {
+		_, err := s.Search(context.Background(), randomSentence(2, 3), searchSize)
+		if err != nil {
+			panic(err)
+		}
+	})
+	f.Stats().Print()
+
+	fmt.Println("=========================================")
+	fmt.Println("SEARCH FULL SOURCE")
+	util.BenchConcurrent(loops, numThreads, func() {
+		_, err := s.SearchFull(context.Background(), randomSentence(2, 3), searchSize)
+		if err != nil {
+			panic(err)
+		}
+	})
+}
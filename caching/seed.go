@@ -0,0 +1,104 @@
+package caching
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed init.sql
+var schemaSQL string
+
+// splitStatements splits a sql script on semicolons, the statements must not contain semicolons in literals
+func splitStatements(script string) []string {
+	var result []string
+	for _, stmt := range strings.Split(script, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if len(stmt) == 0 {
+			continue
+		}
+		result = append(result, stmt)
+	}
+	return result
+}
+
+// ApplySchema creates the products, shops and shops_spatial tables if not existed
+func ApplySchema(ctx context.Context, db *sqlx.DB) error {
+	for _, stmt := range splitStatements(schemaSQL) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeedProducts inserts numProducts generated products, numProducts <= 0 means the number of products in the indices.
+// Products are generated sequentially with the same seed as the elasticsearch load, then inserted in parallel batches
+func SeedProducts(ctx context.Context, repo *Repository, numProducts int, batchSize int, parallelism int) error {
+	if numProducts <= 0 {
+		numProducts = numberOfProducts
+	}
+
+	rand.Seed(randSeed)
+
+	batches := make(chan []ProductContent, parallelism)
+
+	var mut sync.Mutex
+	var firstErr error
+	setErr := func(err error) {
+		mut.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mut.Unlock()
+	}
+	getErr := func() error {
+		mut.Lock()
+		defer mut.Unlock()
+		return firstErr
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+
+	for th := 0; th < parallelism; th++ {
+		go func() {
+			defer wg.Done()
+
+			for batch := range batches {
+				if err := repo.InsertProducts(ctx, batch); err != nil {
+					setErr(err)
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+
+	for k := 0; k < numProducts && getErr() == nil; {
+		n := batchSize
+		if numProducts-k < n {
+			n = numProducts - k
+		}
+
+		batch := make([]ProductContent, 0, n)
+		for i := 0; i < n; i++ {
+			batch = append(batch, ProductContentFromProduct(randomProduct(k)))
+			k++
+		}
+		batches <- batch
+
+		if k%100000 == 0 {
+			fmt.Println("SEEDED:", k, time.Since(start))
+		}
+	}
+	close(batches)
+
+	wg.Wait()
+	return getErr()
+}
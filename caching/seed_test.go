@@ -0,0 +1,29 @@
+package caching
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	assert.Equal(t, []string{"SELECT 1", "SELECT 2"}, splitStatements("\n SELECT 1;\n\n;SELECT 2\n"))
+	assert.Equal(t, 0, len(splitStatements(" ;\n; ")))
+}
+
+func TestSchemaSQL(t *testing.T) {
+	stmts := splitStatements(schemaSQL)
+
+	prefixes := []string{
+		"CREATE TABLE IF NOT EXISTS `products`",
+		"CREATE TABLE IF NOT EXISTS `shops`",
+		"CREATE TABLE IF NOT EXISTS `shops_spatial`",
+	}
+	assert.Equal(t, len(prefixes), len(stmts))
+	for i, stmt := range stmts {
+		if i < len(prefixes) {
+			assert.True(t, strings.HasPrefix(stmt, prefixes[i]), stmt)
+		}
+		assert.True(t, strings.HasSuffix(stmt, ")"), stmt)
+	}
+}
@@ -0,0 +1,271 @@
+package caching
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats is a snapshot of the cache counters, separated per tier
+type CacheStats struct {
+	Gets int64
+
+	L1Hits   int64
+	L1Misses int64
+
+	MemcacheHits   int64
+	MemcacheMisses int64
+	MemcacheErrors int64
+
+	// LeaseRejected counts lease gets rejected because another client is filling the same key
+	LeaseRejected int64
+
+	FillerCalls    int64
+	FillerKeys     int64
+	FillerMaxBatch int64
+
+	DBErrors      int64
+	DBDuration    time.Duration
+	DBMaxDuration time.Duration
+
+	// L1Latency is the latency of the gets served by the in-process cache
+	L1Latency LatencyHistogram
+	// MemcacheLatency is the latency of the other gets, from the call to the result, including fills
+	MemcacheLatency LatencyHistogram
+}
+
+// latencyBuckets are powers of two microseconds, the last one also counts all longer durations
+const latencyBuckets = 32
+
+// LatencyHistogram counts durations in buckets, bucket i holds durations below 2^i microseconds
+type LatencyHistogram struct {
+	Counts [latencyBuckets]int64
+	Total  time.Duration
+}
+
+func latencyBucket(d time.Duration) int {
+	micros := d.Microseconds()
+	index := 0
+	for index < latencyBuckets-1 && int64(1)<<index <= micros {
+		index++
+	}
+	return index
+}
+
+// Count ...
+func (h LatencyHistogram) Count() int64 {
+	var n int64
+	for _, c := range h.Counts {
+		n += c
+	}
+	return n
+}
+
+// Avg ...
+func (h LatencyHistogram) Avg() time.Duration {
+	n := h.Count()
+	if n == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(n)
+}
+
+// Percentile with p in [0, 100] returns the upper bound of the bucket containing it
+func (h LatencyHistogram) Percentile(p float64) time.Duration {
+	n := h.Count()
+	if n == 0 {
+		return 0
+	}
+
+	rank := int64(p * float64(n) / 100.0)
+	if rank >= n {
+		rank = n - 1
+	}
+
+	var seen int64
+	for i, c := range h.Counts {
+		seen += c
+		if seen > rank {
+			return time.Duration(int64(1)<<i) * time.Microsecond
+		}
+	}
+	return time.Duration(int64(1)<<(latencyBuckets-1)) * time.Microsecond
+}
+
+// Sub ...
+func (h LatencyHistogram) Sub(prev LatencyHistogram) LatencyHistogram {
+	result := LatencyHistogram{Total: h.Total - prev.Total}
+	for i := range h.Counts {
+		result.Counts[i] = h.Counts[i] - prev.Counts[i]
+	}
+	return result
+}
+
+func (h LatencyHistogram) print(tier string) {
+	fmt.Printf("%s LATENCY: COUNT: %d, AVG: %v, P50: %v, P90: %v, P99: %v\n",
+		tier, h.Count(), h.Avg(), h.Percentile(50), h.Percentile(90), h.Percentile(99))
+}
+
+func ratio(a, b int64) float64 {
+	if a+b == 0 {
+		return 0
+	}
+	return float64(a) / float64(a+b)
+}
+
+// L1HitRatio ...
+func (s CacheStats) L1HitRatio() float64 {
+	return ratio(s.L1Hits, s.L1Misses)
+}
+
+// MemcacheHitRatio ...
+func (s CacheStats) MemcacheHitRatio() float64 {
+	return ratio(s.MemcacheHits, s.MemcacheMisses)
+}
+
+// AvgFillerBatch is the average number of keys per filler call
+func (s CacheStats) AvgFillerBatch() float64 {
+	if s.FillerCalls == 0 {
+		return 0
+	}
+	return float64(s.FillerKeys) / float64(s.FillerCalls)
+}
+
+// AvgDBDuration is the average duration of the database query per filler call
+func (s CacheStats) AvgDBDuration() time.Duration {
+	if s.FillerCalls == 0 {
+		return 0
+	}
+	return s.DBDuration / time.Duration(s.FillerCalls)
+}
+
+// Sub returns the counters accumulated since the previous snapshot, max values are kept as is
+func (s CacheStats) Sub(prev CacheStats) CacheStats {
+	return CacheStats{
+		Gets: s.Gets - prev.Gets,
+
+		L1Hits:   s.L1Hits - prev.L1Hits,
+		L1Misses: s.L1Misses - prev.L1Misses,
+
+		MemcacheHits:   s.MemcacheHits - prev.MemcacheHits,
+		MemcacheMisses: s.MemcacheMisses - prev.MemcacheMisses,
+		MemcacheErrors: s.MemcacheErrors - prev.MemcacheErrors,
+
+		LeaseRejected: s.LeaseRejected - prev.LeaseRejected,
+
+		FillerCalls:    s.FillerCalls - prev.FillerCalls,
+		FillerKeys:     s.FillerKeys - prev.FillerKeys,
+		FillerMaxBatch: s.FillerMaxBatch,
+
+		DBErrors:      s.DBErrors - prev.DBErrors,
+		DBDuration:    s.DBDuration - prev.DBDuration,
+		DBMaxDuration: s.DBMaxDuration,
+
+		L1Latency:       s.L1Latency.Sub(prev.L1Latency),
+		MemcacheLatency: s.MemcacheLatency.Sub(prev.MemcacheLatency),
+	}
+}
+
+func (s CacheStats) Print() {
+	fmt.Println("GETS:", s.Gets)
+	fmt.Printf("L1 HITS: %d, MISSES: %d, HIT RATIO: %.4f\n", s.L1Hits, s.L1Misses, s.L1HitRatio())
+	fmt.Printf("MEMCACHE HITS: %d, MISSES: %d, HIT RATIO: %.4f, ERRORS: %d\n",
+		s.MemcacheHits, s.MemcacheMisses, s.MemcacheHitRatio(), s.MemcacheErrors)
+	fmt.Println("LEASE REJECTED:", s.LeaseRejected)
+	fmt.Printf("FILLER CALLS: %d, KEYS: %d, AVG BATCH: %.2f, MAX BATCH: %d\n",
+		s.FillerCalls, s.FillerKeys, s.AvgFillerBatch(), s.FillerMaxBatch)
+	fmt.Printf("DB AVG DURATION: %v, MAX DURATION: %v, ERRORS: %d\n",
+		s.AvgDBDuration(), s.DBMaxDuration, s.DBErrors)
+	s.L1Latency.print("L1")
+	s.MemcacheLatency.print("MEMCACHE")
+}
+
+type cacheStats struct {
+	gets atomic.Int64
+
+	l1Hits   atomic.Int64
+	l1Misses atomic.Int64
+
+	memcacheHits   atomic.Int64
+	memcacheMisses atomic.Int64
+	memcacheErrors atomic.Int64
+
+	leaseRejected atomic.Int64
+
+	fillerCalls    atomic.Int64
+	fillerKeys     atomic.Int64
+	fillerMaxBatch atomic.Int64
+
+	dbErrors      atomic.Int64
+	dbDuration    atomic.Int64
+	dbMaxDuration atomic.Int64
+
+	l1Latency       latencyHistogram
+	memcacheLatency latencyHistogram
+}
+
+type latencyHistogram struct {
+	counts [latencyBuckets]atomic.Int64
+	total  atomic.Int64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	h.counts[latencyBucket(d)].Add(1)
+	h.total.Add(int64(d))
+}
+
+func (h *latencyHistogram) snapshot() LatencyHistogram {
+	var result LatencyHistogram
+	for i := range h.counts {
+		result.Counts[i] = h.counts[i].Load()
+	}
+	result.Total = time.Duration(h.total.Load())
+	return result
+}
+
+func atomicMax(v *atomic.Int64, n int64) {
+	for {
+		old := v.Load()
+		if n <= old || v.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
+
+func (s *cacheStats) observeFiller(batchSize int, d time.Duration, err error) {
+	s.fillerCalls.Add(1)
+	s.fillerKeys.Add(int64(batchSize))
+	atomicMax(&s.fillerMaxBatch, int64(batchSize))
+
+	if err != nil {
+		s.dbErrors.Add(1)
+	}
+	s.dbDuration.Add(int64(d))
+	atomicMax(&s.dbMaxDuration, int64(d))
+}
+
+func (s *cacheStats) snapshot() CacheStats {
+	return CacheStats{
+		Gets: s.gets.Load(),
+
+		L1Hits:   s.l1Hits.Load(),
+		L1Misses: s.l1Misses.Load(),
+
+		MemcacheHits:   s.memcacheHits.Load(),
+		MemcacheMisses: s.memcacheMisses.Load(),
+		MemcacheErrors: s.memcacheErrors.Load(),
+
+		LeaseRejected: s.leaseRejected.Load(),
+
+		FillerCalls:    s.fillerCalls.Load(),
+		FillerKeys:     s.fillerKeys.Load(),
+		FillerMaxBatch: s.fillerMaxBatch.Load(),
+
+		DBErrors:      s.dbErrors.Load(),
+		DBDuration:    time.Duration(s.dbDuration.Load()),
+		DBMaxDuration: time.Duration(s.dbMaxDuration.Load()),
+
+		L1Latency:       s.l1Latency.snapshot(),
+		MemcacheLatency: s.memcacheLatency.snapshot(),
+	}
+}
@@ -0,0 +1,67 @@
+package caching
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCacheStats(t *testing.T) {
+	s := &cacheStats{}
+
+	s.observeFiller(10, 4*time.Millisecond, nil)
+	s.observeFiller(30, 2*time.Millisecond, nil)
+
+	prev := s.snapshot()
+	assert.Equal(t, CacheStats{
+		FillerCalls:    2,
+		FillerKeys:     40,
+		FillerMaxBatch: 30,
+
+		DBDuration:    6 * time.Millisecond,
+		DBMaxDuration: 4 * time.Millisecond,
+	}, prev)
+	assert.Equal(t, 20.0, prev.AvgFillerBatch())
+	assert.Equal(t, 3*time.Millisecond, prev.AvgDBDuration())
+
+	s.gets.Add(5)
+	s.observeFiller(5, time.Millisecond, assert.AnError)
+
+	diff := s.snapshot().Sub(prev)
+	assert.Equal(t, int64(5), diff.Gets)
+	assert.Equal(t, int64(1), diff.FillerCalls)
+	assert.Equal(t, int64(5), diff.FillerKeys)
+	assert.Equal(t, int64(1), diff.DBErrors)
+	assert.Equal(t, time.Millisecond, diff.DBDuration)
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	s := &cacheStats{}
+
+	assert.Equal(t, time.Duration(0), s.l1Latency.snapshot().Percentile(50))
+
+	for i := 0; i < 90; i++ {
+		s.l1Latency.observe(3 * time.Microsecond)
+	}
+	for i := 0; i < 10; i++ {
+		s.l1Latency.observe(900 * time.Microsecond)
+	}
+	s.memcacheLatency.observe(time.Hour)
+
+	prev := s.snapshot()
+	h := prev.L1Latency
+	assert.Equal(t, int64(100), h.Count())
+	assert.Equal(t, 92700*time.Nanosecond, h.Avg())
+	assert.Equal(t, 4*time.Microsecond, h.Percentile(50))
+	assert.Equal(t, 1024*time.Microsecond, h.Percentile(90))
+	assert.Equal(t, 1024*time.Microsecond, h.Percentile(100))
+
+	// longer durations are in the last bucket
+	assert.Equal(t, int64(1), prev.MemcacheLatency.Counts[latencyBuckets-1])
+
+	s.l1Latency.observe(0)
+	diff := s.snapshot().Sub(prev)
+	assert.Equal(t, int64(1), diff.L1Latency.Count())
+	assert.Equal(t, int64(1), diff.L1Latency.Counts[0])
+	assert.Equal(t, int64(0), diff.MemcacheLatency.Count())
+}
@@ -0,0 +1,271 @@
+package caching
+
+import (
+	"bench_elastic/util"
+	"context"
+	"fmt"
+	"github.com/QuangTung97/memproxy"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type warmOptions struct {
+	batchSize   int
+	parallelism int
+	ratePerSec  float64
+	afterSKU    string
+	limit       int
+}
+
+// WarmOption ...
+type WarmOption func(opts *warmOptions)
+
+// WithWarmBatchSize sets the page size of the products scan, default is 500
+func WithWarmBatchSize(size int) WarmOption {
+	return func(opts *warmOptions) {
+		opts.batchSize = size
+	}
+}
+
+// WithWarmParallelism sets the number of concurrent memcache writers, default is 4
+func WithWarmParallelism(n int) WarmOption {
+	return func(opts *warmOptions) {
+		opts.parallelism = n
+	}
+}
+
+// WithWarmRateLimit limits the number of products per second, default is no limit
+func WithWarmRateLimit(productsPerSecond float64) WarmOption {
+	return func(opts *warmOptions) {
+		opts.ratePerSec = productsPerSecond
+	}
+}
+
+// WithWarmResumeAfter starts the scan after the sku, normally the LastSKU of a previous report
+func WithWarmResumeAfter(sku string) WarmOption {
+	return func(opts *warmOptions) {
+		opts.afterSKU = sku
+	}
+}
+
+// WithWarmLimit stops after scanning n products, default is no limit
+func WithWarmLimit(n int) WarmOption {
+	return func(opts *warmOptions) {
+		opts.limit = n
+	}
+}
+
+func computeWarmOptions(options []WarmOption) *warmOptions {
+	opts := &warmOptions{
+		batchSize:   500,
+		parallelism: 4,
+	}
+	for _, fn := range options {
+		fn(opts)
+	}
+	return opts
+}
+
+// WarmReport is the result of CacheRepoFactory.WarmUp
+type WarmReport struct {
+	Scanned int64
+	Written int64
+
+	// Skipped counts keys already in memcache or being filled by another client
+	Skipped int64
+	Failed  int64
+
+	// LastSKU is the sku that all products up to it have been processed, used for resuming
+	LastSKU  string
+	Duration time.Duration
+}
+
+func (r WarmReport) Print() {
+	fmt.Println("SCANNED:", r.Scanned)
+	fmt.Println("WRITTEN:", r.Written)
+	fmt.Println("SKIPPED:", r.Skipped)
+	fmt.Println("FAILED:", r.Failed)
+	fmt.Println("LAST SKU:", r.LastSKU)
+	fmt.Println("DURATION:", r.Duration)
+	if r.Duration > 0 {
+		fmt.Println("PRODUCTS PER SECOND:", float64(r.Scanned)/r.Duration.Seconds())
+	}
+}
+
+type warmBatch struct {
+	seq      int
+	contents []ProductContent
+}
+
+// warmProgress tracks the last sku that all batches before it are done, batches finish out of order
+type warmProgress struct {
+	mut     sync.Mutex
+	nextSeq int
+	done    map[int]string
+	lastSKU string
+}
+
+func (p *warmProgress) finish(seq int, lastSKU string) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	p.done[seq] = lastSKU
+	for {
+		sku, ok := p.done[p.nextSeq]
+		if !ok {
+			return
+		}
+		delete(p.done, p.nextSeq)
+		p.lastSKU = sku
+		p.nextSeq++
+	}
+}
+
+type warmCounters struct {
+	scanned atomic.Int64
+	written atomic.Int64
+	skipped atomic.Int64
+	failed  atomic.Int64
+}
+
+// WarmUp scans the products table in sku order with keyset pagination and writes the products to memcache,
+// using the same keys, encoding and lease protocol as CacheRepo
+func (f *CacheRepoFactory) WarmUp(ctx context.Context, options ...WarmOption) (WarmReport, error) {
+	opts := computeWarmOptions(options)
+	limiter := util.NewRateLimiter(opts.ratePerSec)
+
+	start := time.Now()
+
+	progress := &warmProgress{
+		done:    map[int]string{},
+		lastSKU: opts.afterSKU,
+	}
+	var counters warmCounters
+
+	batches := make(chan warmBatch, opts.parallelism)
+
+	var wg sync.WaitGroup
+	wg.Add(opts.parallelism)
+
+	for th := 0; th < opts.parallelism; th++ {
+		go func() {
+			defer wg.Done()
+
+			for batch := range batches {
+				limiter.Wait(len(batch.contents))
+				f.warmBatch(ctx, batch.contents, &counters)
+				progress.finish(batch.seq, batch.contents[len(batch.contents)-1].SKU)
+			}
+		}()
+	}
+
+	scanErr := func() error {
+		defer close(batches)
+
+		afterSKU := opts.afterSKU
+		total := 0
+		for seq := 0; ; seq++ {
+			limit := opts.batchSize
+			if opts.limit > 0 && opts.limit-total < limit {
+				limit = opts.limit - total
+			}
+			if limit <= 0 {
+				return nil
+			}
+
+			contents, err := f.repo.ScanProducts(ctx, afterSKU, limit)
+			if err != nil {
+				return err
+			}
+			if len(contents) == 0 {
+				return nil
+			}
+
+			counters.scanned.Add(int64(len(contents)))
+			total += len(contents)
+			afterSKU = contents[len(contents)-1].SKU
+
+			select {
+			case batches <- warmBatch{seq: seq, contents: contents}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	return WarmReport{
+		Scanned: counters.scanned.Load(),
+		Written: counters.written.Load(),
+		Skipped: counters.skipped.Load(),
+		Failed:  counters.failed.Load(),
+
+		LastSKU:  progress.lastSKU,
+		Duration: time.Since(start),
+	}, scanErr
+}
+
+// warmBatch converts the rows the same way as the filler of CacheRepo, the not found markers get their own TTL
+func (f *CacheRepoFactory) warmBatch(ctx context.Context, contents []ProductContent, counters *warmCounters) {
+	sess := f.provider.New()
+	pipe := f.newPipeline(ctx, sess, nil)
+	defer pipe.Finish()
+
+	keys := make([]ProductKey, 0, len(contents))
+	for _, c := range contents {
+		keys = append(keys, ProductKey{SKU: c.SKU})
+	}
+
+	getFnList := make([]func() (memproxy.LeaseGetResponse, error), 0, len(keys))
+	for _, key := range keys {
+		getFnList = append(getFnList, pipe.LeaseGet(key.String(), memproxy.LeaseGetOptions{}))
+	}
+
+	// every key has a row, so the products are in the order of the keys
+	products := productsFromContents(keys, contents)
+
+	setFnList := make([]func() (memproxy.LeaseSetResponse, error), 0, len(keys))
+	var deleteFnList []func() (memproxy.DeleteResponse, error)
+
+	for i, fn := range getFnList {
+		resp, err := fn()
+		if err != nil {
+			counters.failed.Add(1)
+			continue
+		}
+		if resp.Status != memproxy.LeaseGetStatusLeaseGranted {
+			counters.skipped.Add(1)
+			continue
+		}
+
+		key := keys[i].String()
+		data, err := products[i].Marshal()
+		if err != nil {
+			// releases the lease, the readers do not wait for it to expire
+			counters.failed.Add(1)
+			deleteFnList = append(deleteFnList, pipe.Delete(key, memproxy.DeleteOptions{}))
+			continue
+		}
+
+		setFnList = append(setFnList, pipe.LeaseSet(key, data, resp.CAS, memproxy.LeaseSetOptions{}))
+	}
+
+	for _, fn := range setFnList {
+		resp, err := fn()
+		if err != nil {
+			counters.failed.Add(1)
+			continue
+		}
+		if resp.Status != memproxy.LeaseSetStatusStored {
+			counters.skipped.Add(1)
+			continue
+		}
+		counters.written.Add(1)
+	}
+
+	for _, fn := range deleteFnList {
+		_, _ = fn()
+	}
+}
@@ -0,0 +1,53 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWarmProgress(t *testing.T) {
+	p := &warmProgress{
+		done:    map[int]string{},
+		lastSKU: "SKU00",
+	}
+
+	p.finish(1, "SKU20")
+	assert.Equal(t, "SKU00", p.lastSKU)
+
+	p.finish(2, "SKU30")
+	assert.Equal(t, "SKU00", p.lastSKU)
+
+	p.finish(0, "SKU10")
+	assert.Equal(t, "SKU30", p.lastSKU)
+	assert.Equal(t, 0, len(p.done))
+
+	p.finish(3, "SKU40")
+	assert.Equal(t, "SKU40", p.lastSKU)
+}
+
+func TestCacheRepoFactory_WarmUp(t *testing.T) {
+	f := NewCacheFactory(memcacheAddrs, NewDB())
+	defer func() { _ = f.Close() }()
+
+	report, err := f.WarmUp(context.Background(),
+		WithWarmLimit(20000),
+		WithWarmRateLimit(5000),
+	)
+	report.Print()
+	assert.Equal(t, nil, err)
+
+	// the warm up is only counted in its report
+	assert.Equal(t, CacheStats{}, f.Stats())
+
+	fmt.Println("=========================================")
+	fmt.Println("RESUME")
+
+	report, err = f.WarmUp(context.Background(),
+		WithWarmLimit(20000),
+		WithWarmResumeAfter(report.LastSKU),
+	)
+	report.Print()
+	assert.Equal(t, nil, err)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bench_elastic/caching"
+	"context"
+	"flag"
+	"strings"
+)
+
+func main() {
+	memcacheAddrs := flag.String("memcache", "localhost:11211", "comma separated memcache addresses")
+	batchSize := flag.Int("batch", 500, "number of products per scanned page")
+	parallelism := flag.Int("parallel", 4, "number of concurrent memcache writers")
+	rate := flag.Float64("rate", 0, "max products per second, 0 is unlimited")
+	afterSKU := flag.String("after", "", "resume after this sku")
+	limit := flag.Int("limit", 0, "max number of products, 0 is unlimited")
+	flag.Parse()
+
+	f := caching.NewCacheFactory(strings.Split(*memcacheAddrs, ","), caching.NewDB())
+	defer func() { _ = f.Close() }()
+
+	report, err := f.WarmUp(context.Background(),
+		caching.WithWarmBatchSize(*batchSize),
+		caching.WithWarmParallelism(*parallelism),
+		caching.WithWarmRateLimit(*rate),
+		caching.WithWarmResumeAfter(*afterSKU),
+		caching.WithWarmLimit(*limit),
+	)
+	report.Print()
+	if err != nil {
+		panic(err)
+	}
+}
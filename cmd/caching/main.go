@@ -1,15 +1,9 @@
 package main
 
 import (
-	"bench_elastic/pb"
-	"fmt"
-	"google.golang.org/protobuf/encoding/protojson"
+	"bench_elastic/caching"
 )
 
 func main() {
-	data, err := protojson.Marshal(&pb.Product{
-		Sku:  "SKU001",
-		Name: "Quang Tung",
-	})
-	fmt.Println(string(data), err)
+	caching.PrintEncodingReport(10000)
 }
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/QuangTung97/geohash"
+)
+
+// maxCoverCells limits the keys of a box or polygon search, a viewport is larger than a radius search
+const maxCoverCells = 32
+
+// maxCoverSide stops the covering near the poles and the antimeridian
+const maxCoverSide = 1024
+
+func (b BoundingBox) toRectangle() [4]Location {
+	return [4]Location{
+		{Lat: b.MinLat, Lon: b.MinLon},
+		{Lat: b.MinLat, Lon: b.MaxLon},
+		{Lat: b.MaxLat, Lon: b.MaxLon},
+		{Lat: b.MaxLat, Lon: b.MinLon},
+	}
+}
+
+// boxAround is the smallest box containing the circle of radius km centered at l,
+// clamped to valid coordinates, a circle crossing the antimeridian is cut at it
+func boxAround(l Location, radius float64) BoundingBox {
+	angle := radius / earthRadiusKm
+	dLat := angle * 180 / math.Pi
+
+	dLon := 180.0
+	if sinLon := math.Sin(angle) / math.Cos(l.Lat*math.Pi/180); angle < math.Pi/2 && sinLon < 1 {
+		dLon = math.Asin(sinLon) * 180 / math.Pi
+	}
+
+	box := BoundingBox{
+		MinLat: math.Max(l.Lat-dLat, -90),
+		MaxLat: math.Min(l.Lat+dLat, 90),
+		MinLon: math.Max(l.Lon-dLon, -180),
+		MaxLon: math.Min(l.Lon+dLon, 180),
+	}
+	if dLon >= 180 {
+		// the circle contains a pole
+		box.MinLon = -180
+		box.MaxLon = 180
+	}
+	return box
+}
+
+// starAround is a concave polygon of 2 * numPoints vertices, alternating radiusKm and radiusKm / 2
+func starAround(l Location, radiusKm float64, numPoints int) []Location {
+	result := make([]Location, 0, 2*numPoints)
+	for i := 0; i < 2*numPoints; i++ {
+		r := radiusKm
+		if i%2 == 1 {
+			r = radiusKm / 2
+		}
+		angle := float64(i) * math.Pi / float64(numPoints)
+		result = append(result, Location{
+			Lat: l.Lat + r*math.Sin(angle)/kmPerDegree,
+			Lon: l.Lon + r*math.Cos(angle)/(kmPerDegree*math.Cos(l.Lat*math.Pi/180)),
+		})
+	}
+	return result
+}
+
+// pointInPolygon is ray casting on the (lon, lat) plane, the same planar edges as ES geo_polygon
+func pointInPolygon(l Location, polygon []Location) bool {
+	inside := false
+	j := len(polygon) - 1
+	for i := range polygon {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > l.Lat) != (b.Lat > l.Lat) {
+			lon := a.Lon + (l.Lat-a.Lat)*(b.Lon-a.Lon)/(b.Lat-a.Lat)
+			if l.Lon < lon {
+				inside = !inside
+			}
+		}
+		j = i
+	}
+	return inside
+}
+
+func cross(o, a, b Location) float64 {
+	return (a.Lon-o.Lon)*(b.Lat-o.Lat) - (a.Lat-o.Lat)*(b.Lon-o.Lon)
+}
+
+func segmentsIntersect(a, b, c, d Location) bool {
+	d1 := cross(c, d, a)
+	d2 := cross(c, d, b)
+	d3 := cross(a, b, c)
+	d4 := cross(a, b, d)
+	return ((d1 > 0) != (d2 > 0)) && ((d3 > 0) != (d4 > 0))
+}
+
+// boxIntersectsPolygon is true when the box has a corner in the polygon,
+// the polygon has a vertex in the box, or their edges cross
+func boxIntersectsPolygon(box BoundingBox, polygon []Location) bool {
+	corners := box.toRectangle()
+	for _, c := range corners {
+		if pointInPolygon(c, polygon) {
+			return true
+		}
+	}
+	if box.contains(polygon[0]) {
+		return true
+	}
+
+	j := len(polygon) - 1
+	for i := range polygon {
+		for k := range corners {
+			if segmentsIntersect(polygon[j], polygon[i], corners[k], corners[(k+1)%4]) {
+				return true
+			}
+		}
+		j = i
+	}
+	return false
+}
+
+func cellBox(h geohash.Hash) BoundingBox {
+	rec := h.Rec()
+	return BoundingBox{
+		MinLat: rec.BottomLeft.Lat,
+		MaxLat: rec.TopLeft.Lat,
+		MinLon: rec.BottomLeft.Lon,
+		MaxLon: rec.BottomRight.Lon,
+	}
+}
+
+// coverBox returns the cells of precision p intersecting the box, row by row from the bottom left
+func coverBox(box BoundingBox, p uint32) []geohash.Hash {
+	var result []geohash.Hash
+
+	row := geohash.ComputeGeohash(geohash.Pos{Lat: box.MinLat, Lon: box.MinLon}, p)
+	for i := 0; i < maxCoverSide && row.Pos().Lat <= box.MaxLat; i++ {
+		h := row
+		for k := 0; k < maxCoverSide && h.Pos().Lon <= box.MaxLon; k++ {
+			result = append(result, h)
+			h = h.Right()
+		}
+		row = row.Top()
+	}
+	return result
+}
+
+// estimateBoxCells is an upper bound of len(coverBox(box, p))
+func estimateBoxCells(box BoundingBox, p uint32) int {
+	w, h := cellSizeKm(p, box.MinLat)
+	widthKm := (box.MaxLon - box.MinLon) * kmPerDegree * math.Cos(box.MinLat*math.Pi/180)
+	heightKm := (box.MaxLat - box.MinLat) * kmPerDegree
+	nx := int(math.Ceil(widthKm/w)) + 1
+	ny := int(math.Ceil(heightKm/h)) + 1
+	return nx * ny
+}
+
+// chooseBoxPrecision is choosePrecision for a box covering
+func chooseBoxPrecision(box BoundingBox, available []uint32) uint32 {
+	result := available[0]
+	for _, p := range available {
+		if p < result {
+			result = p
+		}
+	}
+	for _, p := range available {
+		if p > result && estimateBoxCells(box, p) <= maxCoverCells {
+			result = p
+		}
+	}
+	return result
+}
+
+// coverPolygon is coverBox of the bounding box without the cells outside the polygon
+func coverPolygon(polygon []Location, p uint32) []geohash.Hash {
+	var result []geohash.Hash
+	for _, h := range coverBox(boundingBoxOf(polygon), p) {
+		if boxIntersectsPolygon(cellBox(h), polygon) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+func filterInBox(box BoundingBox, candidates []ShopModel) []Shop {
+	result := make([]Shop, 0, len(candidates))
+	for _, m := range candidates {
+		s := m.toShop()
+		if box.contains(s.Location) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func filterInPolygon(polygon []Location, candidates []ShopModel) []Shop {
+	result := make([]Shop, 0, len(candidates))
+	for _, m := range candidates {
+		s := m.toShop()
+		if pointInPolygon(s.Location, polygon) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// inBoxByCells and inPolygonByCells are the area searches of the geohash backends
+
+func inBoxByCells(box BoundingBox, available []uint32, fetch func(hashes []string) ([]ShopModel, error)) ([]Shop, error) {
+	p := chooseBoxPrecision(box, available)
+
+	cells := coverBox(box, p)
+	if len(cells) == 0 {
+		return nil, nil
+	}
+	candidates, err := fetch(hashStrings(cells))
+	if err != nil {
+		return nil, err
+	}
+	return filterInBox(box, candidates), nil
+}
+
+func inPolygonByCells(polygon []Location, available []uint32, fetch func(hashes []string) ([]ShopModel, error)) ([]Shop, error) {
+	p := chooseBoxPrecision(boundingBoxOf(polygon), available)
+
+	cells := coverPolygon(polygon, p)
+	if len(cells) == 0 {
+		return nil, nil
+	}
+	candidates, err := fetch(hashStrings(cells))
+	if err != nil {
+		return nil, err
+	}
+	return filterInPolygon(polygon, candidates), nil
+}
+
+func boxQuery(halfKm float64) GeoQuery {
+	return GeoQuery{
+		Name: fmt.Sprintf("box %vkm", 2*halfKm),
+		Run: func(b GeoBackend, pos Location) ([]Shop, error) {
+			return b.InBox(boxAround(pos, halfKm))
+		},
+	}
+}
+
+func polygonQuery(radiusKm float64) GeoQuery {
+	return GeoQuery{
+		Name: fmt.Sprintf("polygon %vkm", radiusKm),
+		Run: func(b GeoBackend, pos Location) ([]Shop, error) {
+			return b.InPolygon(starAround(pos, radiusKm, 5))
+		},
+	}
+}
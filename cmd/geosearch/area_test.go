@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/QuangTung97/geohash"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var testSquare = []Location{
+	{Lat: 0, Lon: 0},
+	{Lat: 0, Lon: 1},
+	{Lat: 1, Lon: 1},
+	{Lat: 1, Lon: 0},
+}
+
+func TestPointInPolygon(t *testing.T) {
+	assert.True(t, pointInPolygon(Location{Lat: 0.5, Lon: 0.5}, testSquare))
+	assert.False(t, pointInPolygon(Location{Lat: 1.5, Lon: 0.5}, testSquare))
+	assert.False(t, pointInPolygon(Location{Lat: 0.5, Lon: -0.5}, testSquare))
+
+	center := Location{Lat: 21.0, Lon: 105.8}
+	star := starAround(center, 1, 5)
+	assert.Equal(t, 10, len(star))
+	assert.True(t, pointInPolygon(center, star))
+
+	// at the angle of an inner vertex (0.5km), but 0.8km away
+	between := starAround(center, 1.6, 5)[1]
+	assert.False(t, pointInPolygon(between, star))
+}
+
+func TestBoxIntersectsPolygon(t *testing.T) {
+	// inside
+	assert.True(t, boxIntersectsPolygon(BoundingBox{MinLat: 0.4, MaxLat: 0.6, MinLon: 0.4, MaxLon: 0.6}, testSquare))
+	// contains the polygon
+	assert.True(t, boxIntersectsPolygon(BoundingBox{MinLat: -1, MaxLat: 2, MinLon: -1, MaxLon: 2}, testSquare))
+	// edges cross, no corner inside each other
+	assert.True(t, boxIntersectsPolygon(BoundingBox{MinLat: 0.4, MaxLat: 0.6, MinLon: -1, MaxLon: 2}, testSquare))
+	// outside
+	assert.False(t, boxIntersectsPolygon(BoundingBox{MinLat: 2, MaxLat: 3, MinLon: 2, MaxLon: 3}, testSquare))
+}
+
+func TestCoverBox__Contains_Every_Location(t *testing.T) {
+	rand.Seed(77)
+
+	box := boxAround(Location{Lat: 21.0, Lon: 105.8}, 1)
+	for _, p := range []uint32{5, 6, 7} {
+		cells := map[string]bool{}
+		for _, h := range coverBox(box, p) {
+			cells[h.String()] = true
+		}
+		assert.LessOrEqual(t, len(cells), estimateBoxCells(box, p))
+
+		points := newUniformPoints(box)
+		for i := 0; i < 1000; i++ {
+			l := points.Next()
+			h := geohash.ComputeGeohash(geohash.Pos{Lat: l.Lat, Lon: l.Lon}, p)
+			assert.True(t, cells[h.String()])
+		}
+	}
+}
+
+func TestCoverPolygon__Fewer_Cells_Than_Box(t *testing.T) {
+	star := starAround(Location{Lat: 21.0, Lon: 105.8}, 2, 5)
+	assert.Less(t, len(coverPolygon(star, 7)), len(coverBox(boundingBoxOf(star), 7)))
+}
+
+func TestChooseBoxPrecision(t *testing.T) {
+	box := boxAround(Location{Lat: 21.0, Lon: 105.8}, 0.5)
+	p := chooseBoxPrecision(box, allPrecisions)
+	assert.LessOrEqual(t, estimateBoxCells(box, p), maxCoverCells)
+	assert.Greater(t, estimateBoxCells(box, p+1), maxCoverCells)
+
+	assert.Equal(t, uint32(6), chooseBoxPrecision(box, []uint32{6}))
+}
+
+func TestBoxAround__Contains_Circle(t *testing.T) {
+	for _, lat := range []float64{0, 21.0, 60, 85} {
+		center := Location{Lat: lat, Lon: 105.8}
+		for _, radius := range []float64{0.5, 10, 500} {
+			box := boxAround(center, radius)
+
+			// points on the circle
+			for i := 0; i < 360; i++ {
+				angle := float64(i) * math.Pi / 180
+				l := destination(center, radius*0.9999, angle)
+				assert.True(t, box.contains(l), "lat=%v radius=%v angle=%d", lat, radius, i)
+			}
+		}
+	}
+
+	box := boxAround(Location{Lat: 89.9, Lon: 179.9}, 100)
+	assert.Equal(t, 90.0, box.MaxLat)
+	assert.Equal(t, -180.0, box.MinLon)
+	assert.Equal(t, 180.0, box.MaxLon)
+}
+
+// destination is the location at distance km from l, in the direction of bearing (radian, 0 = north)
+func destination(l Location, distance float64, bearing float64) Location {
+	lat1 := l.Lat * math.Pi / 180
+	lon1 := l.Lon * math.Pi / 180
+	d := distance / earthRadiusKm
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(bearing))
+	lon2 := lon1 + math.Atan2(math.Sin(bearing)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+
+	return Location{Lat: lat2 * 180 / math.Pi, Lon: lon2 * 180 / math.Pi}
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bench_elastic/pb"
+	"bench_elastic/util"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/QuangTung97/geohash"
+	"github.com/QuangTung97/go-memcache/memcache"
+	"github.com/QuangTung97/haversine"
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/golang/protobuf/proto"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// GeoBackend is one way of storing shops and searching them by location, radius is in km
+type GeoBackend interface {
+	Name() string
+
+	// Load writes one batch of shops, it is used as a writer of loadShops
+	Load(shops []Shop) error
+
+	// Nearby returns all shops within radius of (lat, lon), in no particular order
+	Nearby(lat, lon, radius float64) ([]Shop, error)
+
+	// Nearest returns the n closest shops to (lat, lon), sorted by haversine distance, none for n < 1
+	Nearest(lat, lon float64, n int) ([]Shop, error)
+
+	// InBox returns all shops inside the box, in no particular order
+	InBox(box BoundingBox) ([]Shop, error)
+
+	// InPolygon returns all shops inside the polygon, the last vertex is connected to the first.
+	// Edges are straight lines on the (lon, lat) plane
+	InPolygon(polygon []Location) ([]Shop, error)
+}
+
+func backendWriter(b GeoBackend) shopWriter {
+	return shopWriter{
+		name:  b.Name(),
+		write: b.Load,
+	}
+}
+
+func (m ShopModel) toShop() Shop {
+	return Shop{
+		ID: m.ID,
+		Location: Location{
+			Lat: m.Lat,
+			Lon: m.Lon,
+		},
+	}
+}
+
+func distanceKm(a, b Location) float64 {
+	return haversine.DistanceEarth(
+		haversine.Pos{Lat: a.Lat, Lon: a.Lon},
+		haversine.Pos{Lat: b.Lat, Lon: b.Lon},
+	)
+}
+
+// filterWithinRadius removes the candidates of the geohash cells that are outside the circle
+func filterWithinRadius(origin Location, candidates []ShopModel, radius float64) []Shop {
+	result := make([]Shop, 0, len(candidates))
+	for _, s := range candidates {
+		shop := s.toShop()
+		if distanceKm(origin, shop.Location) <= radius {
+			result = append(result, shop)
+		}
+	}
+	return result
+}
+
+func nearbyHashes(lat, lon, radius float64, p uint32) []string {
+	hashList := geohash.NearbyGeohashList(geohash.Pos{
+		Lat: lat,
+		Lon: lon,
+	}, radius, p)
+
+	hashes := make([]string, 0, len(hashList))
+	for _, h := range hashList {
+		hashes = append(hashes, h.String())
+	}
+	return hashes
+}
+
+// ===============================================
+// Elasticsearch
+// ===============================================
+
+// esMaxNearby is the page size of Nearby, the result is truncated above it
+const esMaxNearby = 1000
+
+type esBackend struct {
+	client *elasticsearch.Client
+}
+
+func newESBackend(client *elasticsearch.Client) *esBackend {
+	return &esBackend{client: client}
+}
+
+func (*esBackend) Name() string {
+	return "elasticsearch"
+}
+
+func (b *esBackend) Load(shops []Shop) error {
+	return indexShops(b.client, shops)
+}
+
+type esShopHit struct {
+	Source Shop `json:"_source"`
+}
+
+type esShopResponse struct {
+	Hits struct {
+		Hits []esShopHit `json:"hits"`
+	} `json:"hits"`
+}
+
+func (b *esBackend) search(query map[string]interface{}) ([]Shop, error) {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.Search(b.client.Search.WithIndex(indexName), b.client.Search.WithBody(bytes.NewReader(body)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.IsError() {
+		data, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("search error: %s", string(data))
+	}
+
+	var result esShopResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	shops := make([]Shop, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		shops = append(shops, hit.Source)
+	}
+	return shops, nil
+}
+
+func (b *esBackend) Nearby(lat, lon, radius float64) ([]Shop, error) {
+	return b.filterSearch(map[string]interface{}{
+		"geo_distance": map[string]interface{}{
+			"distance": fmt.Sprintf("%vkm", radius),
+			"location": Location{Lat: lat, Lon: lon},
+		},
+	})
+}
+
+func (b *esBackend) Nearest(lat, lon float64, n int) ([]Shop, error) {
+	if n < 1 {
+		return nil, nil
+	}
+	origin := Location{Lat: lat, Lon: lon}
+
+	shops, err := b.search(map[string]interface{}{
+		"sort": []interface{}{
+			map[string]interface{}{
+				"_geo_distance": map[string]interface{}{
+					"location":      origin,
+					"order":         "asc",
+					"unit":          "km",
+					"distance_type": "arc",
+				},
+			},
+		},
+		"size": n,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the same order as the other backends for ties and float differences
+	sortByDistance(origin, shops)
+	return shops, nil
+}
+
+func (b *esBackend) filterSearch(filter map[string]interface{}) ([]Shop, error) {
+	return b.search(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{filter},
+			},
+		},
+		"size": esMaxNearby,
+	})
+}
+
+func (b *esBackend) InBox(box BoundingBox) ([]Shop, error) {
+	return b.filterSearch(map[string]interface{}{
+		"geo_bounding_box": map[string]interface{}{
+			"location": map[string]interface{}{
+				"top_left":     Location{Lat: box.MaxLat, Lon: box.MinLon},
+				"bottom_right": Location{Lat: box.MinLat, Lon: box.MaxLon},
+			},
+		},
+	})
+}
+
+func (b *esBackend) InPolygon(polygon []Location) ([]Shop, error) {
+	return b.filterSearch(map[string]interface{}{
+		"geo_polygon": map[string]interface{}{
+			"location": map[string]interface{}{
+				"points": polygon,
+			},
+		},
+	})
+}
+
+// ===============================================
+// MySQL with geohash column
+// ===============================================
+
+type mysqlGeohashBackend struct {
+	db *sqlx.DB
+
+	checkOnce sync.Once
+	checkErr  error
+}
+
+// errReloadRequired is returned for rows loaded with another geohash precision, e.g. the 6-character
+// hashes of the first versions, the prefix queries would silently miss them
+var errReloadRequired = fmt.Errorf(
+	"shops table has geohashes of another precision than %d, reload required: truncate shops and run with -load",
+	storedPrecision,
+)
+
+func newMySQLGeohashBackend(db *sqlx.DB, numConns int) *mysqlGeohashBackend {
+	db.SetMaxOpenConns(numConns)
+	db.SetMaxIdleConns(numConns)
+	return &mysqlGeohashBackend{db: db}
+}
+
+func (*mysqlGeohashBackend) Name() string {
+	return "mysql"
+}
+
+func (b *mysqlGeohashBackend) Load(shops []Shop) error {
+	return insertShops(b.db, shops)
+}
+
+// checkStoredPrecision runs once, before the first query
+func (b *mysqlGeohashBackend) checkStoredPrecision() error {
+	b.checkOnce.Do(func() {
+		var stale bool
+		err := b.db.Get(&stale,
+			`SELECT EXISTS (SELECT 1 FROM shops WHERE CHAR_LENGTH(geohash) <> ?)`, storedPrecision)
+		if err != nil {
+			b.checkErr = err
+			return
+		}
+		if stale {
+			b.checkErr = errReloadRequired
+		}
+	})
+	return b.checkErr
+}
+
+// fetchCells uses equality for cells of storedPrecision, prefix ranges for coarser cells
+func (b *mysqlGeohashBackend) fetchCells(hashes []string) ([]ShopModel, error) {
+	if err := b.checkStoredPrecision(); err != nil {
+		return nil, err
+	}
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	var query string
+	var args []interface{}
+
+	if len(hashes[0]) == storedPrecision {
+		var err error
+		query, args, err = sqlx.In(`SELECT id, lat, lon, geohash FROM shops WHERE geohash IN (?)`, hashes)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		conditions := make([]string, 0, len(hashes))
+		for _, h := range hashes {
+			conditions = append(conditions, "geohash LIKE ?")
+			args = append(args, h+"%")
+		}
+		query = `SELECT id, lat, lon, geohash FROM shops WHERE ` + strings.Join(conditions, " OR ")
+	}
+
+	var result []ShopModel
+	if err := b.db.Select(&result, query, args...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *mysqlGeohashBackend) Nearby(lat, lon, radius float64) ([]Shop, error) {
+	p := choosePrecision(radius, lat, defaultMaxCells, allPrecisions)
+
+	result, err := b.fetchCells(nearbyHashes(lat, lon, radius, p))
+	if err != nil {
+		return nil, err
+	}
+	return filterWithinRadius(Location{Lat: lat, Lon: lon}, result, radius), nil
+}
+
+func (b *mysqlGeohashBackend) Nearest(lat, lon float64, n int) ([]Shop, error) {
+	return nearestByRings(Location{Lat: lat, Lon: lon}, n, precision, b.fetchCells)
+}
+
+func (b *mysqlGeohashBackend) InBox(box BoundingBox) ([]Shop, error) {
+	return inBoxByCells(box, allPrecisions, b.fetchCells)
+}
+
+func (b *mysqlGeohashBackend) InPolygon(polygon []Location) ([]Shop, error) {
+	return inPolygonByCells(polygon, allPrecisions, b.fetchCells)
+}
+
+// ===============================================
+// Memcache with geohash buckets
+// ===============================================
+
+// memcacheGeohashBackend keeps one set of buckets per precision, a shop is in every set
+type memcacheGeohashBackend struct {
+	client     *memcacheCluster
+	precisions []uint32
+
+	// maxBucketShops is the size above which a bucket is split into buckets of the next precision, 0 = never.
+	// Splits happen on Load and rebuild, updates of a split bucket go to its children
+	maxBucketShops int
+
+	// scanned is the number of shops read from the buckets, before the radius filter
+	scanned atomic.Int64
+
+	updates updateMetrics
+}
+
+func newMemcacheGeohashBackend(client *memcacheCluster, precisions ...uint32) *memcacheGeohashBackend {
+	if len(precisions) == 0 {
+		precisions = []uint32{precision}
+	}
+	return &memcacheGeohashBackend{
+		client:     client,
+		precisions: precisions,
+	}
+}
+
+func (*memcacheGeohashBackend) Name() string {
+	return "memcache"
+}
+
+func (b *memcacheGeohashBackend) Load(shops []Shop) error {
+	for _, p := range b.precisions {
+		if err := mergeShopBuckets(b.client, shopsToModels(shops, p), b.maxBucketShops); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuild overwrites the buckets of all shops, it returns the number of buckets of each precision.
+// Unlike Load, running it again does not duplicate shops
+func (b *memcacheGeohashBackend) rebuild(shops []Shop) (int, error) {
+	numBuckets := 0
+	for _, p := range b.precisions {
+		buckets, splits := b.layout(shops, p)
+		numBuckets = len(buckets)
+
+		if err := writeLayout(b.client, buckets, splits); err != nil {
+			return 0, err
+		}
+	}
+	return numBuckets, nil
+}
+
+func unmarshalShopEntry(data []byte) ([]ShopModel, error) {
+	var entry pb.ShopEntry
+	if err := proto.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	result := make([]ShopModel, 0, len(entry.Shops))
+	for _, s := range entry.Shops {
+		result = append(result, ShopModel{
+			ID:  s.Id,
+			Lat: s.Lat,
+			Lon: s.Lon,
+		})
+	}
+	return result, nil
+}
+
+// fetchCells reads the buckets then the children of the split ones, one round trip per level
+func (b *memcacheGeohashBackend) fetchCells(hashes []string) ([]ShopModel, error) {
+	result := make([]ShopModel, 0, 100)
+
+	for len(hashes) > 0 {
+		p := b.client.Pipeline()
+
+		respList := make([]func() (memcache.MGetResponse, error), 0, len(hashes))
+		for _, h := range hashes {
+			respList = append(respList, p.MGet(h, memcache.MGetOptions{}))
+		}
+
+		var children []string
+		for i, fn := range respList {
+			resp, err := fn()
+			if err != nil {
+				p.Finish()
+				return nil, err
+			}
+			if resp.Type != memcache.MGetResponseTypeVA {
+				continue
+			}
+			if isSplitMarker(resp.Data) {
+				children = append(children, geohashChildren(hashes[i])...)
+				continue
+			}
+
+			shops, err := unmarshalShopEntry(resp.Data)
+			if err != nil {
+				p.Finish()
+				return nil, err
+			}
+			result = append(result, shops...)
+		}
+
+		p.Finish()
+		hashes = children
+	}
+
+	b.scanned.Add(int64(len(result)))
+	return result, nil
+}
+
+func (b *memcacheGeohashBackend) Nearby(lat, lon, radius float64) ([]Shop, error) {
+	p := choosePrecision(radius, lat, defaultMaxCells, b.precisions)
+
+	result, err := b.fetchCells(nearbyHashes(lat, lon, radius, p))
+	if err != nil {
+		return nil, err
+	}
+	return filterWithinRadius(Location{Lat: lat, Lon: lon}, result, radius), nil
+}
+
+func (b *memcacheGeohashBackend) Nearest(lat, lon float64, n int) ([]Shop, error) {
+	p := closestPrecision(precision, b.precisions)
+	return nearestByRings(Location{Lat: lat, Lon: lon}, n, p, b.fetchCells)
+}
+
+func (b *memcacheGeohashBackend) InBox(box BoundingBox) ([]Shop, error) {
+	return inBoxByCells(box, b.precisions, b.fetchCells)
+}
+
+func (b *memcacheGeohashBackend) InPolygon(polygon []Location) ([]Shop, error) {
+	return inPolygonByCells(polygon, b.precisions, b.fetchCells)
+}
+
+// ===============================================
+// Driver
+// ===============================================
+
+// GeoBenchResult is the statistics of one backend, each run has its own durations
+type GeoBenchResult struct {
+	Backend string
+	Query   string
+	Points  string
+	Result  util.BenchResult
+
+	TotalShops int64
+}
+
+func (r GeoBenchResult) AvgShops() float64 {
+	return float64(r.TotalShops) / float64(r.Result.Requests)
+}
+
+func (r GeoBenchResult) Print() {
+	fmt.Println("=========================================")
+	fmt.Println("BACKEND:", r.Backend)
+	fmt.Println("QUERY:", r.Query)
+	fmt.Println("POINTS:", r.Points)
+	r.Result.Print()
+	fmt.Printf("AVG SHOPS: %.2f\n", r.AvgShops())
+}
+
+// printGeoBenchTable prints one line per result, to compare backends side by side
+func printGeoBenchTable(results []GeoBenchResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	_, _ = fmt.Fprintln(w, "BACKEND\tQUERY\tPOINTS\tP50\tP90\tP99\tMAX\tQPS\tAVG SHOPS\t")
+	for _, r := range results {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%v\t%v\t%v\t%.1f\t%.2f\t\n",
+			r.Backend, r.Query, r.Points,
+			r.Result.Percentile(50).Round(time.Microsecond),
+			r.Result.Percentile(90).Round(time.Microsecond),
+			r.Result.Percentile(99).Round(time.Microsecond),
+			r.Result.MaxDuration().Round(time.Microsecond),
+			r.Result.QPS(), r.AvgShops(),
+		)
+	}
+	_ = w.Flush()
+}
+
+// GeoQuery is one kind of search of a backend
+type GeoQuery struct {
+	Name string
+	Run  func(b GeoBackend, pos Location) ([]Shop, error)
+
+	// Boundary is the distance from pos at which a shop can be either in or out of the result,
+	// nil when there is no such distance
+	Boundary func(pos Location, expected []Shop) float64
+}
+
+func nearbyQuery(radius float64) GeoQuery {
+	return GeoQuery{
+		Name: fmt.Sprintf("nearby %vkm", radius),
+		Run: func(b GeoBackend, pos Location) ([]Shop, error) {
+			return b.Nearby(pos.Lat, pos.Lon, radius)
+		},
+		Boundary: func(pos Location, expected []Shop) float64 {
+			return radius
+		},
+	}
+}
+
+func nearestQuery(n int) GeoQuery {
+	return GeoQuery{
+		Name: fmt.Sprintf("nearest %d", n),
+		Run: func(b GeoBackend, pos Location) ([]Shop, error) {
+			return b.Nearest(pos.Lat, pos.Lon, n)
+		},
+		Boundary: func(pos Location, expected []Shop) float64 {
+			if len(expected) == 0 {
+				return math.Inf(1)
+			}
+			return distanceKm(pos, expected[len(expected)-1].Location)
+		},
+	}
+}
+
+func runGeoBench(
+	b GeoBackend, query GeoQuery, points PointGenerator,
+	requestsPerThread int, numThreads int,
+) GeoBenchResult {
+	var totalShops atomic.Int64
+
+	result := util.RunConcurrent(requestsPerThread, numThreads, func() {
+		shops, err := query.Run(b, points.Next())
+		if err != nil {
+			panic(err)
+		}
+		totalShops.Add(int64(len(shops)))
+	})
+
+	return GeoBenchResult{
+		Backend:    b.Name(),
+		Query:      query.Name,
+		Points:     points.Name(),
+		Result:     result,
+		TotalShops: totalShops.Load(),
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilterWithinRadius(t *testing.T) {
+	origin := Location{Lat: 21.0, Lon: 105.8}
+
+	result := filterWithinRadius(origin, []ShopModel{
+		{ID: 1, Lat: 21.0, Lon: 105.8},
+		{ID: 2, Lat: 21.004, Lon: 105.8}, // ~0.44km
+		{ID: 3, Lat: 21.005, Lon: 105.8}, // ~0.56km
+		{ID: 4, Lat: 21.0, Lon: 105.9},
+	}, 0.5)
+
+	assert.Equal(t, []Shop{
+		{ID: 1, Location: Location{Lat: 21.0, Lon: 105.8}},
+		{ID: 2, Location: Location{Lat: 21.004, Lon: 105.8}},
+	}, result)
+}
+
+func TestNearbyHashes__Contains_Origin_Cell(t *testing.T) {
+	hashes := nearbyHashes(21.0, 105.8, 0.5, precision)
+	origin := shopsToModels([]Shop{{Location: Location{Lat: 21.0, Lon: 105.8}}}, precision)[0].Geohash
+	assert.Contains(t, hashes, origin)
+}
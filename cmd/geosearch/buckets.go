@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/QuangTung97/geohash"
+	"github.com/QuangTung97/go-memcache/memcache"
+)
+
+// splitMarker replaces a bucket split into its 32 children of the next precision.
+// A ShopEntry can not start with a zero byte, field numbers start from 1
+var splitMarker = []byte{0}
+
+func isSplitMarker(data []byte) bool {
+	return len(data) == 1 && data[0] == 0
+}
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+func geohashChildren(key string) []string {
+	result := make([]string, 0, len(geohashAlphabet))
+	for _, c := range geohashAlphabet {
+		result = append(result, key+string(c))
+	}
+	return result
+}
+
+func withPrecision(m ShopModel, p uint32) ShopModel {
+	m.Geohash = geohash.ComputeGeohash(geohash.Pos{Lat: m.Lat, Lon: m.Lon}, p).String()
+	return m
+}
+
+func childKey(l Location, parent string) string {
+	return geohash.ComputeGeohash(geohash.Pos{Lat: l.Lat, Lon: l.Lon}, uint32(len(parent)+1)).String()
+}
+
+// layoutBuckets puts the shops of key into out, splitting recursively while there are more than maxShops
+// shops and the precision is below maxPrecision. maxShops <= 0 never splits. It returns the split keys
+func layoutBuckets(key string, shops []ShopModel, maxShops int, out map[string][]ShopModel) []string {
+	if maxShops <= 0 || len(shops) <= maxShops || len(key) >= maxPrecision {
+		out[key] = shops
+		return nil
+	}
+
+	children := map[string][]ShopModel{}
+	for _, s := range shops {
+		child := withPrecision(s, uint32(len(key)+1))
+		children[child.Geohash] = append(children[child.Geohash], child)
+	}
+
+	splits := []string{key}
+	for child, list := range children {
+		splits = append(splits, layoutBuckets(child, list, maxShops, out)...)
+	}
+	return splits
+}
+
+// layout is the buckets of precision p holding shops, without the split keys
+func (b *memcacheGeohashBackend) layout(shops []Shop, p uint32) (map[string][]ShopModel, []string) {
+	out := map[string][]ShopModel{}
+	var splits []string
+	for key, list := range groupByGeohash(shopsToModels(shops, p)) {
+		splits = append(splits, layoutBuckets(key, list, b.maxBucketShops, out)...)
+	}
+	return out, splits
+}
+
+// writeLayout sets the children before the split markers
+func writeLayout(client *memcacheCluster, buckets map[string][]ShopModel, splits []string) error {
+	pipe := client.Pipeline()
+	defer pipe.Finish()
+
+	fns := make([]func() (memcache.MSetResponse, error), 0, len(buckets)+len(splits))
+	for k, v := range buckets {
+		fns = append(fns, pipe.MSet(k, marshalShopEntry(v), memcache.MSetOptions{}))
+	}
+	for _, k := range splits {
+		fns = append(fns, pipe.MSet(k, splitMarker, memcache.MSetOptions{}))
+	}
+
+	for _, fn := range fns {
+		if _, err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeByID replaces the shops of the bucket having the same id
+func mergeByID(bucket []ShopModel, shops []ShopModel) []ShopModel {
+	ids := make(map[int64]struct{}, len(shops))
+	for _, s := range shops {
+		ids[s.ID] = struct{}{}
+	}
+
+	result := make([]ShopModel, 0, len(bucket)+len(shops))
+	for _, s := range bucket {
+		if _, ok := ids[s.ID]; !ok {
+			result = append(result, s)
+		}
+	}
+	return append(result, shops...)
+}
+
+// mergeShopBuckets merges shops into the existing geohash buckets, a bucket can be filled by many batches.
+// Shops of split buckets go down to the children, buckets growing above maxShops are split.
+// It is a plain read-modify-write, the loader must be the only writer of the buckets
+func mergeShopBuckets(client *memcacheCluster, shops []ShopModel, maxShops int) error {
+	shopMap := groupByGeohash(shops)
+
+	p := client.Pipeline()
+	defer p.Finish()
+
+	getFns := make(map[string]func() (memcache.MGetResponse, error), len(shopMap))
+	for hash := range shopMap {
+		getFns[hash] = p.MGet(hash, memcache.MGetOptions{})
+	}
+
+	buckets := map[string][]ShopModel{}
+	var splits []string
+	var descend []ShopModel
+
+	for hash, newShops := range shopMap {
+		resp, err := getFns[hash]()
+		if err != nil {
+			return err
+		}
+
+		var bucket []ShopModel
+		if resp.Type == memcache.MGetResponseTypeVA {
+			if isSplitMarker(resp.Data) {
+				for _, s := range newShops {
+					descend = append(descend, withPrecision(s, uint32(len(hash)+1)))
+				}
+				continue
+			}
+
+			bucket, err = unmarshalShopEntry(resp.Data)
+			if err != nil {
+				return err
+			}
+		}
+
+		splits = append(splits, layoutBuckets(hash, mergeByID(bucket, newShops), maxShops, buckets)...)
+	}
+
+	if err := writeLayout(client, buckets, splits); err != nil {
+		return err
+	}
+	if len(descend) > 0 {
+		return mergeShopBuckets(client, descend, maxShops)
+	}
+	return nil
+}
+
+// BucketSize ...
+type BucketSize struct {
+	Key   string
+	Shops int
+	Bytes int
+}
+
+// HistogramBin counts the buckets with at most Upper shops, and more than the Upper of the previous bin
+type HistogramBin struct {
+	Upper int
+	Count int
+}
+
+// BucketStats is the distribution of the bucket payloads of one precision
+type BucketStats struct {
+	Precision uint32
+	MaxShops  int // the split threshold, 0 = no split
+
+	Buckets int
+	Splits  int
+	Shops   int
+
+	P50 int
+	P90 int
+	P99 int
+	Max int
+
+	TotalBytes int
+	MaxBytes   int
+
+	Histogram []HistogramBin
+	Top       []BucketSize
+}
+
+func computeBucketStats(buckets map[string][]ShopModel, topN int) BucketStats {
+	sizes := make([]BucketSize, 0, len(buckets))
+	for k, v := range buckets {
+		sizes = append(sizes, BucketSize{
+			Key:   k,
+			Shops: len(v),
+			Bytes: len(marshalShopEntry(v)),
+		})
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Shops != sizes[j].Shops {
+			return sizes[i].Shops > sizes[j].Shops
+		}
+		return sizes[i].Key < sizes[j].Key
+	})
+
+	var stats BucketStats
+	stats.Buckets = len(sizes)
+	if len(sizes) == 0 {
+		return stats
+	}
+
+	percentile := func(p float64) int {
+		// sizes is in decreasing order
+		index := int((100 - p) / 100 * float64(len(sizes)))
+		if index >= len(sizes) {
+			index = len(sizes) - 1
+		}
+		return sizes[index].Shops
+	}
+	stats.P50 = percentile(50)
+	stats.P90 = percentile(90)
+	stats.P99 = percentile(99)
+	stats.Max = sizes[0].Shops
+
+	for i := len(sizes) - 1; i >= 0; i-- {
+		s := sizes[i]
+		stats.Shops += s.Shops
+		stats.TotalBytes += s.Bytes
+		if s.Bytes > stats.MaxBytes {
+			stats.MaxBytes = s.Bytes
+		}
+
+		upper := 1
+		for upper < s.Shops {
+			upper *= 2
+		}
+		if n := len(stats.Histogram); n == 0 || stats.Histogram[n-1].Upper != upper {
+			stats.Histogram = append(stats.Histogram, HistogramBin{Upper: upper})
+		}
+		stats.Histogram[len(stats.Histogram)-1].Count++
+	}
+
+	if len(sizes) > topN {
+		sizes = sizes[:topN]
+	}
+	stats.Top = sizes
+	return stats
+}
+
+// bucketStats computes the layout of every precision of the backend, without writing it
+func (b *memcacheGeohashBackend) bucketStats(shops []Shop, topN int) []BucketStats {
+	result := make([]BucketStats, 0, len(b.precisions))
+	for _, p := range b.precisions {
+		buckets, splits := b.layout(shops, p)
+
+		stats := computeBucketStats(buckets, topN)
+		stats.Precision = p
+		stats.MaxShops = b.maxBucketShops
+		stats.Splits = len(splits)
+		result = append(result, stats)
+	}
+	return result
+}
+
+func (s BucketStats) Print() {
+	fmt.Println("=========================================")
+	fmt.Println("PRECISION:", s.Precision)
+	fmt.Println("SPLIT ABOVE:", s.MaxShops)
+	fmt.Println("BUCKETS:", s.Buckets)
+	fmt.Println("SPLITS:", s.Splits)
+	fmt.Println("SHOPS:", s.Shops)
+	fmt.Printf("SHOPS PER BUCKET: P50=%d P90=%d P99=%d MAX=%d\n", s.P50, s.P90, s.P99, s.Max)
+	if s.Buckets > 0 {
+		fmt.Printf("BYTES PER BUCKET: AVG=%d MAX=%d\n", s.TotalBytes/s.Buckets, s.MaxBytes)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(w, "SHOPS <=\tBUCKETS\t")
+	for _, bin := range s.Histogram {
+		_, _ = fmt.Fprintf(w, "%d\t%d\t\n", bin.Upper, bin.Count)
+	}
+	_ = w.Flush()
+
+	fmt.Println("TOP BUCKETS:")
+	for _, b := range s.Top {
+		fmt.Printf("  %s: %d shops, %d bytes\n", b.Key, b.Shops, b.Bytes)
+	}
+}
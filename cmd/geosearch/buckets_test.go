@@ -0,0 +1,151 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestIsSplitMarker(t *testing.T) {
+	assert.Equal(t, true, isSplitMarker(splitMarker))
+	assert.Equal(t, false, isSplitMarker(nil))
+	assert.Equal(t, false, isSplitMarker(marshalShopEntry([]ShopModel{{ID: 1, Lat: 21, Lon: 105.8}})))
+}
+
+func TestLayoutBuckets(t *testing.T) {
+	rand.Seed(99)
+	box := BoundingBox{MinLat: 21.0, MaxLat: 21.01, MinLon: 105.8, MaxLon: 105.81}
+	shops := randomShopModels(500, box)
+
+	const p = 5
+	key := withPrecision(shops[0], p).Geohash
+	var inCell []ShopModel
+	for _, s := range shops {
+		s = withPrecision(s, p)
+		if s.Geohash == key {
+			inCell = append(inCell, s)
+		}
+	}
+
+	// no split
+	out := map[string][]ShopModel{}
+	assert.Equal(t, 0, len(layoutBuckets(key, inCell, 0, out)))
+	assert.Equal(t, map[string][]ShopModel{key: inCell}, out)
+
+	out = map[string][]ShopModel{}
+	splits := layoutBuckets(key, inCell, 20, out)
+	assert.Equal(t, key, splits[0])
+
+	var ids []int64
+	for k, list := range out {
+		assert.LessOrEqual(t, len(list), 20, k)
+		for _, s := range list {
+			assert.Equal(t, k, s.Geohash)
+			ids = append(ids, s.ID)
+		}
+	}
+	for _, k := range splits {
+		_, ok := out[k]
+		assert.Equal(t, false, ok, k)
+	}
+
+	// every shop is in exactly one bucket
+	var expected []int64
+	for _, s := range inCell {
+		expected = append(expected, s.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+	assert.Equal(t, expected, ids)
+}
+
+func TestLayoutBuckets__Max_Precision_Not_Split(t *testing.T) {
+	var shops []ShopModel
+	for i := 0; i < 10; i++ {
+		shops = append(shops, ShopModel{ID: int64(i), Lat: 21, Lon: 105.8, Geohash: "w7er8u0e"})
+	}
+
+	out := map[string][]ShopModel{}
+	assert.Equal(t, 0, len(layoutBuckets("w7er8u0e", shops, 2, out)))
+	assert.Equal(t, 10, len(out["w7er8u0e"]))
+}
+
+func TestMergeByID(t *testing.T) {
+	bucket := []ShopModel{{ID: 1}, {ID: 2, Lat: 1}}
+	merged := mergeByID(bucket, []ShopModel{{ID: 2, Lat: 2}, {ID: 3}})
+	assert.Equal(t, []ShopModel{{ID: 1}, {ID: 2, Lat: 2}, {ID: 3}}, merged)
+}
+
+func TestComputeBucketStats(t *testing.T) {
+	buckets := map[string][]ShopModel{}
+	for i := 0; i < 10; i++ {
+		key := geohashAlphabet[i : i+1]
+		for j := 0; j <= i; j++ {
+			buckets[key] = append(buckets[key], ShopModel{ID: int64(j)})
+		}
+	}
+
+	stats := computeBucketStats(buckets, 3)
+	assert.Equal(t, 10, stats.Buckets)
+	assert.Equal(t, 55, stats.Shops)
+	assert.Equal(t, 10, stats.Max)
+	assert.Equal(t, 5, stats.P50)
+	assert.Equal(t, 10, stats.P99)
+	assert.Equal(t, []HistogramBin{
+		{Upper: 1, Count: 1},
+		{Upper: 2, Count: 1},
+		{Upper: 4, Count: 2},
+		{Upper: 8, Count: 4},
+		{Upper: 16, Count: 2},
+	}, stats.Histogram)
+	assert.Equal(t, []string{"9", "8", "7"}, []string{stats.Top[0].Key, stats.Top[1].Key, stats.Top[2].Key})
+
+	assert.Equal(t, BucketStats{}, computeBucketStats(nil, 3))
+}
+
+func TestMemcacheGeohashBackend__Split_Buckets_Same_As_Brute_Force(t *testing.T) {
+	rand.Seed(77)
+
+	client := newMemcacheCluster(memcacheAddrs, 8)
+	defer func() { _ = client.Close() }()
+
+	box := BoundingBox{MinLat: 21.0, MaxLat: 21.04, MinLon: 105.8, MaxLon: 105.84}
+	var shops []Shop
+	for _, m := range randomShopModels(2000, box) {
+		shops = append(shops, m.toShop())
+	}
+
+	reference := newBruteForceBackend()
+	assert.Equal(t, nil, reference.Load(shops))
+
+	b := newMemcacheGeohashBackend(client, 5, 6)
+	b.maxBucketShops = 30
+	_, err := b.rebuild(shops)
+	if !assert.Equal(t, nil, err) {
+		return
+	}
+
+	for _, query := range []GeoQuery{nearbyQuery(0.5), nearestQuery(10), boxQuery(1)} {
+		reports, err := verifyBackends(reference, []GeoBackend{b}, query, newUniformPoints(box), 100)
+		if !assert.Equal(t, nil, err, query.Name) || !assert.Equal(t, 1, len(reports), query.Name) {
+			return
+		}
+		assert.Equal(t, 0, len(reports[0].Mismatches), query.Name)
+	}
+
+	// moves go down to the children of the split buckets
+	moved := shops[0]
+	to := Location{Lat: 21.02, Lon: 105.82}
+	assert.Equal(t, nil, b.MoveShop(moved, to))
+
+	nearby, err := b.Nearby(to.Lat, to.Lon, 0.01)
+	assert.Equal(t, nil, err)
+	found := 0
+	for _, n := range nearby {
+		if n.ID == moved.ID {
+			found++
+		}
+	}
+	assert.Equal(t, 1, found)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/QuangTung97/geohash"
+)
+
+// maxKNNRings bounds the ring expansion when there are fewer than n shops around
+const maxKNNRings = 64
+
+// sortByDistance sorts shops by haversine distance to origin, ties by id
+func sortByDistance(origin Location, shops []Shop) {
+	sort.Slice(shops, func(i, j int) bool {
+		a := distanceKm(origin, shops[i].Location)
+		b := distanceKm(origin, shops[j].Location)
+		if a != b {
+			return a < b
+		}
+		return shops[i].ID < shops[j].ID
+	})
+}
+
+// geohashRing returns the cells at Chebyshev distance k from center, ring 0 is the center itself
+func geohashRing(center geohash.Hash, k int) []geohash.Hash {
+	if k == 0 {
+		return []geohash.Hash{center}
+	}
+
+	// start at the bottom left corner then walk the four sides counter-clockwise
+	h := center
+	for i := 0; i < k; i++ {
+		h = h.Left().Bottom()
+	}
+
+	moves := []func(geohash.Hash) geohash.Hash{
+		geohash.Hash.Right,
+		geohash.Hash.Top,
+		geohash.Hash.Left,
+		geohash.Hash.Bottom,
+	}
+
+	result := make([]geohash.Hash, 0, 8*k)
+	for _, move := range moves {
+		for i := 0; i < 2*k; i++ {
+			result = append(result, h)
+			h = move(h)
+		}
+	}
+	return result
+}
+
+func clamp(x, min, max float64) float64 {
+	return math.Max(min, math.Min(max, x))
+}
+
+// minDistanceToCell is the distance from origin to the closest point of the cell, 0 if origin is inside
+func minDistanceToCell(origin Location, cell geohash.Hash) float64 {
+	rec := cell.Rec()
+	nearest := Location{
+		Lat: clamp(origin.Lat, rec.BottomLeft.Lat, rec.TopLeft.Lat),
+		Lon: clamp(origin.Lon, rec.BottomLeft.Lon, rec.BottomRight.Lon),
+	}
+	return distanceKm(origin, nearest)
+}
+
+func ringMinDistance(origin Location, ring []geohash.Hash) float64 {
+	result := math.Inf(1)
+	for _, cell := range ring {
+		result = math.Min(result, minDistanceToCell(origin, cell))
+	}
+	return result
+}
+
+func hashStrings(hashes []geohash.Hash) []string {
+	result := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		result = append(result, h.String())
+	}
+	return result
+}
+
+// nearestByRings expands the neighbour rings of the origin cell until the n-th closest candidate
+// is certified: no shop of the next ring can be closer than it
+func nearestByRings(
+	origin Location, n int, cellPrecision uint32,
+	fetch func(hashes []string) ([]ShopModel, error),
+) ([]Shop, error) {
+	if n < 1 {
+		return nil, nil
+	}
+
+	center := geohash.ComputeGeohash(geohash.Pos{Lat: origin.Lat, Lon: origin.Lon}, cellPrecision)
+
+	var candidates []Shop
+	ring := geohashRing(center, 0)
+
+	for k := 0; ; k++ {
+		models, err := fetch(hashStrings(ring))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range models {
+			candidates = append(candidates, m.toShop())
+		}
+		sortByDistance(origin, candidates)
+
+		ring = geohashRing(center, k+1)
+		if len(candidates) >= n {
+			if distanceKm(origin, candidates[n-1].Location) <= ringMinDistance(origin, ring) {
+				return candidates[:n], nil
+			}
+		}
+		if k >= maxKNNRings {
+			break
+		}
+	}
+
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates, nil
+}
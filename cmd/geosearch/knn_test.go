@@ -0,0 +1,134 @@
+package main
+
+import (
+	"github.com/QuangTung97/geohash"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestGeohashRing(t *testing.T) {
+	center := geohash.ComputeGeohash(geohash.Pos{Lat: 21.0, Lon: 105.8}, 6)
+
+	assert.Equal(t, []geohash.Hash{center}, geohashRing(center, 0))
+
+	seen := map[string]bool{center.String(): true}
+	for k := 1; k <= 3; k++ {
+		ring := geohashRing(center, k)
+		assert.Equal(t, 8*k, len(ring))
+		for _, h := range ring {
+			assert.False(t, seen[h.String()], h.String())
+			seen[h.String()] = true
+		}
+	}
+
+	ring1 := hashStrings(geohashRing(center, 1))
+	assert.ElementsMatch(t, []string{
+		center.Left().String(), center.Right().String(),
+		center.Top().String(), center.Bottom().String(),
+		center.Left().Top().String(), center.Left().Bottom().String(),
+		center.Right().Top().String(), center.Right().Bottom().String(),
+	}, ring1)
+}
+
+func TestMinDistanceToCell(t *testing.T) {
+	origin := Location{Lat: 21.0, Lon: 105.8}
+	center := geohash.ComputeGeohash(geohash.Pos{Lat: origin.Lat, Lon: origin.Lon}, 6)
+
+	assert.Equal(t, 0.0, minDistanceToCell(origin, center))
+	assert.Greater(t, minDistanceToCell(origin, center.Right().Right()), 0.0)
+}
+
+func randomShopModels(n int, box BoundingBox) []ShopModel {
+	shops := make([]Shop, 0, n)
+	for i := 0; i < n; i++ {
+		shops = append(shops, Shop{
+			ID: int64(i + 1),
+			Location: Location{
+				Lat: randFloat64(box.MinLat, box.MaxLat),
+				Lon: randFloat64(box.MinLon, box.MaxLon),
+			},
+		})
+	}
+	return shopsToModels(shops, precision)
+}
+
+func TestNearestByRings__Same_As_Brute_Force(t *testing.T) {
+	rand.Seed(1234)
+
+	box := BoundingBox{MinLat: 20.9, MaxLat: 21.1, MinLon: 105.7, MaxLon: 105.9}
+	models := randomShopModels(2000, box)
+
+	cells := map[string][]ShopModel{}
+	for _, m := range models {
+		cells[m.Geohash] = append(cells[m.Geohash], m)
+	}
+	fetch := func(hashes []string) ([]ShopModel, error) {
+		var result []ShopModel
+		for _, h := range hashes {
+			result = append(result, cells[h]...)
+		}
+		return result, nil
+	}
+
+	all := make([]Shop, 0, len(models))
+	for _, m := range models {
+		all = append(all, m.toShop())
+	}
+
+	points := newUniformPoints(box)
+	for i := 0; i < 100; i++ {
+		origin := points.Next()
+
+		result, err := nearestByRings(origin, 10, precision, fetch)
+		assert.Equal(t, nil, err)
+
+		sortByDistance(origin, all)
+		assert.Equal(t, all[:10], result)
+	}
+}
+
+func TestNearestByRings__Fewer_Shops_Than_N(t *testing.T) {
+	models := shopsToModels([]Shop{
+		{ID: 1, Location: Location{Lat: 21.0, Lon: 105.8}},
+		{ID: 2, Location: Location{Lat: 21.001, Lon: 105.8}},
+	}, precision)
+	fetch := func(hashes []string) ([]ShopModel, error) {
+		var result []ShopModel
+		for _, h := range hashes {
+			for _, m := range models {
+				if m.Geohash == h {
+					result = append(result, m)
+				}
+			}
+		}
+		return result, nil
+	}
+
+	result, err := nearestByRings(Location{Lat: 21.0011, Lon: 105.8}, 5, precision, fetch)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int64{2, 1}, []int64{result[0].ID, result[1].ID})
+	assert.Equal(t, 2, len(result))
+}
+
+func TestNearest__Non_Positive_N(t *testing.T) {
+	shops := []Shop{{ID: 1, Location: Location{Lat: 21.0, Lon: 105.8}}}
+
+	fetch := func(hashes []string) ([]ShopModel, error) {
+		return shopsToModels(shops, precision), nil
+	}
+	for _, n := range []int{0, -1} {
+		result, err := nearestByRings(Location{Lat: 21.0, Lon: 105.8}, n, precision, fetch)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 0, len(result))
+	}
+
+	for _, b := range []GeoBackend{newKDTreeBackend(), newBruteForceBackend(), newGridBackend(6)} {
+		assert.Equal(t, nil, b.Load(shops))
+		for _, n := range []int{0, -1} {
+			result, err := b.Nearest(21.0, 105.8, n)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, 0, len(result), b.Name())
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bench_elastic/pb"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/golang/protobuf/proto"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RowError is a rejected row of the shops file, Line starts from 1 and includes the header
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// LoadReport ...
+type LoadReport struct {
+	Rows     int
+	Loaded   int
+	Rejected []RowError
+	Duration time.Duration
+}
+
+func (r LoadReport) Print() {
+	fmt.Println("=========================================")
+	fmt.Println("ROWS:", r.Rows)
+	fmt.Println("LOADED:", r.Loaded)
+	fmt.Println("REJECTED:", len(r.Rejected))
+	for _, e := range r.Rejected {
+		fmt.Println("  ", e.Error())
+	}
+	fmt.Println("DURATION:", r.Duration)
+}
+
+var errTooManyBadRows = errors.New("too many bad rows")
+
+var errLoadCanceled = errors.New("load canceled")
+
+func parseShopRow(row []string) (Shop, error) {
+	if len(row) != 3 {
+		return Shop{}, fmt.Errorf("expected 3 columns, got %d", len(row))
+	}
+
+	id, err := strconv.ParseInt(row[0], 10, 64)
+	if err != nil {
+		return Shop{}, fmt.Errorf("invalid id: %w", err)
+	}
+
+	lat, err := strconv.ParseFloat(row[1], 64)
+	if err != nil {
+		return Shop{}, fmt.Errorf("invalid lat: %w", err)
+	}
+	if lat < -90 || lat > 90 {
+		return Shop{}, fmt.Errorf("lat out of range: %v", lat)
+	}
+
+	lon, err := strconv.ParseFloat(row[2], 64)
+	if err != nil {
+		return Shop{}, fmt.Errorf("invalid lon: %w", err)
+	}
+	if lon < -180 || lon > 180 {
+		return Shop{}, fmt.Errorf("lon out of range: %v", lon)
+	}
+
+	return Shop{
+		ID: id,
+		Location: Location{
+			Lat: lat,
+			Lon: lon,
+		},
+	}, nil
+}
+
+// streamShops reads the csv in batches of batchSize shops and closes out when done, or stops with errLoadCanceled
+// when done is closed. Bad rows are collected into the report, it stops with errTooManyBadRows after maxBadRows
+// of them (< 0 = no limit). checkDuplicates keeps the id and line of every loaded row in memory,
+// tens of bytes per row, disable it for files too large for that
+func streamShops(
+	r io.Reader, batchSize int, maxBadRows int, checkDuplicates bool,
+	out chan<- []Shop, done <-chan struct{},
+) (LoadReport, error) {
+	defer close(out)
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var report LoadReport
+	firstLine := map[int64]int{}
+
+	reject := func(line int, err error) error {
+		report.Rejected = append(report.Rejected, RowError{Line: line, Err: err})
+		if maxBadRows >= 0 && len(report.Rejected) > maxBadRows {
+			return errTooManyBadRows
+		}
+		return nil
+	}
+
+	batch := make([]Shop, 0, batchSize)
+	for index := 0; ; index++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if index == 0 {
+			if err != nil {
+				return report, err
+			}
+			continue
+		}
+
+		report.Rows++
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return report, err
+			}
+			if err := reject(parseErr.StartLine, err); err != nil {
+				return report, err
+			}
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		shop, err := parseShopRow(row)
+		if err == nil && checkDuplicates {
+			if prev, existed := firstLine[shop.ID]; existed {
+				err = fmt.Errorf("duplicated id %d, first seen at line %d", shop.ID, prev)
+			}
+		}
+		if err != nil {
+			if err := reject(line, err); err != nil {
+				return report, err
+			}
+			continue
+		}
+
+		if checkDuplicates {
+			firstLine[shop.ID] = line
+		}
+		report.Loaded++
+
+		batch = append(batch, shop)
+		if len(batch) >= batchSize {
+			select {
+			case out <- batch:
+			case <-done:
+				return report, errLoadCanceled
+			}
+			batch = make([]Shop, 0, batchSize)
+		}
+	}
+
+	if len(batch) > 0 {
+		select {
+		case out <- batch:
+		case <-done:
+			return report, errLoadCanceled
+		}
+	}
+	return report, nil
+}
+
+// shopWriter consumes the batches of the loader in its own goroutine
+type shopWriter struct {
+	name  string
+	write func(shops []Shop) error
+}
+
+// loadShops streams the shops file to all writers, every writer receives every batch.
+// The first failed writer cancels the reading of the file, the other writers finish the batches already read
+func loadShops(
+	filename string, batchSize int, maxBadRows int, checkDuplicates bool, writers ...shopWriter,
+) (LoadReport, error) {
+	start := time.Now()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return LoadReport{}, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var wg sync.WaitGroup
+	wg.Add(len(writers))
+
+	var errMut sync.Mutex
+	var writeErr error
+
+	done := make(chan struct{})
+	var cancelOnce sync.Once
+
+	channels := make([]chan []Shop, 0, len(writers))
+	for _, w := range writers {
+		ch := make(chan []Shop, 4)
+		channels = append(channels, ch)
+
+		go func(w shopWriter) {
+			defer wg.Done()
+
+			failed := false
+			for shops := range ch {
+				if failed {
+					continue
+				}
+				if err := w.write(shops); err != nil {
+					failed = true
+
+					errMut.Lock()
+					if writeErr == nil {
+						writeErr = fmt.Errorf("writer %s: %w", w.name, err)
+					}
+					errMut.Unlock()
+
+					cancelOnce.Do(func() { close(done) })
+				}
+			}
+		}(w)
+	}
+
+	batches := make(chan []Shop, 4)
+	go func() {
+		for shops := range batches {
+			for _, ch := range channels {
+				ch <- shops
+			}
+		}
+		for _, ch := range channels {
+			close(ch)
+		}
+	}()
+
+	report, err := streamShops(file, batchSize, maxBadRows, checkDuplicates, batches, done)
+	wg.Wait()
+	report.Duration = time.Since(start)
+
+	if writeErr != nil {
+		return report, writeErr
+	}
+	return report, err
+}
+
+func indexShops(client *elasticsearch.Client, shops []Shop) error {
+	var buf bytes.Buffer
+	buildBulkRequestBody(&buf, shops)
+
+	resp, err := client.Bulk(&buf, client.Bulk.WithIndex(indexName))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.IsError() || resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("bulk index error: %s", string(data))
+	}
+	return nil
+}
+
+func insertShops(db *sqlx.DB, shops []Shop) error {
+	query := `
+INSERT INTO shops (id, lat, lon, geohash)
+VALUES (:id, :lat, :lon, :geohash)
+`
+	_, err := db.NamedExec(query, shopsToModels(shops, storedPrecision))
+	return err
+}
+
+func groupByGeohash(shops []ShopModel) map[string][]ShopModel {
+	shopMap := map[string][]ShopModel{}
+	for _, s := range shops {
+		shopMap[s.Geohash] = append(shopMap[s.Geohash], s)
+	}
+	return shopMap
+}
+
+func marshalShopEntry(shops []ShopModel) []byte {
+	pbShops := make([]*pb.Shop, 0, len(shops))
+	for _, s := range shops {
+		pbShops = append(pbShops, &pb.Shop{
+			Id:  s.ID,
+			Lat: s.Lat,
+			Lon: s.Lon,
+		})
+	}
+
+	data, err := proto.Marshal(&pb.ShopEntry{
+		Shops: pbShops,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
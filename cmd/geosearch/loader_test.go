@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func collectBatches(ch <-chan []Shop) func() [][]Shop {
+	done := make(chan [][]Shop)
+	go func() {
+		var batches [][]Shop
+		for shops := range ch {
+			batches = append(batches, shops)
+		}
+		done <- batches
+	}()
+	return func() [][]Shop {
+		return <-done
+	}
+}
+
+func TestStreamShops(t *testing.T) {
+	input := `"id","lat","lon"
+1,21.0,105.8
+2,21.1,105.9
+abc,21.1,105.9
+3,91.0,105.9
+4,21.0,181.0
+2,21.2,105.7
+5,21.3
+6,21.4,105.6
+`
+	ch := make(chan []Shop)
+	wait := collectBatches(ch)
+
+	report, err := streamShops(strings.NewReader(input), 2, -1, true, ch, nil)
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, [][]Shop{
+		{
+			{ID: 1, Location: Location{Lat: 21.0, Lon: 105.8}},
+			{ID: 2, Location: Location{Lat: 21.1, Lon: 105.9}},
+		},
+		{
+			{ID: 6, Location: Location{Lat: 21.4, Lon: 105.6}},
+		},
+	}, wait())
+
+	assert.Equal(t, 8, report.Rows)
+	assert.Equal(t, 3, report.Loaded)
+
+	lines := make([]int, 0, len(report.Rejected))
+	for _, e := range report.Rejected {
+		lines = append(lines, e.Line)
+	}
+	assert.Equal(t, []int{4, 5, 6, 7, 8}, lines)
+	assert.Equal(t, "line 7: duplicated id 2, first seen at line 3", report.Rejected[3].Error())
+}
+
+func TestStreamShops__Too_Many_Bad_Rows(t *testing.T) {
+	input := `"id","lat","lon"
+1,21.0,105.8
+x,21.1,105.9
+y,21.1,105.9
+3,21.0,105.8
+`
+	ch := make(chan []Shop)
+	wait := collectBatches(ch)
+
+	report, err := streamShops(strings.NewReader(input), 10, 1, true, ch, nil)
+	assert.Equal(t, errTooManyBadRows, err)
+	assert.Equal(t, 0, len(wait()))
+	assert.Equal(t, 2, len(report.Rejected))
+}
+
+func TestStreamShops__No_Duplicate_Check(t *testing.T) {
+	input := `"id","lat","lon"
+1,21.0,105.8
+1,21.1,105.9
+`
+	ch := make(chan []Shop)
+	wait := collectBatches(ch)
+
+	report, err := streamShops(strings.NewReader(input), 10, -1, false, ch, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, report.Loaded)
+	assert.Equal(t, 1, len(wait()))
+}
+
+func TestStreamShops__Canceled(t *testing.T) {
+	input := `"id","lat","lon"
+1,21.0,105.8
+2,21.1,105.9
+3,21.2,105.9
+`
+	done := make(chan struct{})
+	close(done)
+
+	// nobody reads the batches
+	ch := make(chan []Shop)
+	report, err := streamShops(strings.NewReader(input), 1, -1, true, ch, done)
+	assert.Equal(t, errLoadCanceled, err)
+	assert.Equal(t, 1, report.Loaded)
+}
+
+func TestLoadShops__Writer_Error_Stops_Reading(t *testing.T) {
+	var buf strings.Builder
+	buf.WriteString("\"id\",\"lat\",\"lon\"\n")
+	for i := 1; i <= 1000; i++ {
+		buf.WriteString(fmt.Sprintf("%d,21.0,105.8\n", i))
+	}
+
+	filename := filepath.Join(t.TempDir(), "shops.csv")
+	assert.Equal(t, nil, os.WriteFile(filename, []byte(buf.String()), 0o644))
+
+	var written int
+	report, err := loadShops(filename, 10, -1, true,
+		shopWriter{
+			name: "failed",
+			write: func(shops []Shop) error {
+				return assert.AnError
+			},
+		},
+		shopWriter{
+			name: "ok",
+			write: func(shops []Shop) error {
+				written += len(shops)
+				return nil
+			},
+		},
+	)
+	assert.Equal(t, "writer failed: "+assert.AnError.Error(), err.Error())
+	assert.Less(t, report.Loaded, 1000)
+	assert.LessOrEqual(t, written, report.Loaded)
+}
@@ -1,28 +1,22 @@
 package main
 
 import (
-	"bench_elastic/pb"
-	"bytes"
-	"encoding/csv"
+	"bench_elastic/caching"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"github.com/QuangTung97/haversine"
 	"github.com/elastic/go-elasticsearch/v7"
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/golang/protobuf/proto"
 	"github.com/jmoiron/sqlx"
 	"io"
-	"math/rand"
 	"net"
 	"net/http"
-	"os"
-	"sort"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/QuangTung97/geohash"
-	"github.com/QuangTung97/go-memcache/memcache"
 )
 
 type Location struct {
@@ -35,9 +29,10 @@ type Shop struct {
 	Location Location `json:"location"`
 }
 
+// precision is the default geohash precision of the buckets, a cell is about 1.2km x 0.6km
 const precision = 6
 
-func (s Shop) toModel() ShopModel {
+func (s Shop) toModel(p uint32) ShopModel {
 	return ShopModel{
 		ID:  s.ID,
 		Lat: s.Location.Lat,
@@ -45,14 +40,14 @@ func (s Shop) toModel() ShopModel {
 		Geohash: geohash.ComputeGeohash(geohash.Pos{
 			Lat: s.Location.Lat,
 			Lon: s.Location.Lon,
-		}, precision).String(),
+		}, p).String(),
 	}
 }
 
-func shopsToModels(shops []Shop) []ShopModel {
+func shopsToModels(shops []Shop, p uint32) []ShopModel {
 	result := make([]ShopModel, 0, len(shops))
 	for _, s := range shops {
-		result = append(result, s.toModel())
+		result = append(result, s.toModel(p))
 	}
 	return result
 }
@@ -64,71 +59,6 @@ type ShopModel struct {
 	Geohash string  `db:"geohash"`
 }
 
-func loadShops(filename string) []Shop {
-	file, err := os.Open(filename)
-	if err != nil {
-		panic(err)
-	}
-	defer func() { _ = file.Close() }()
-
-	reader := csv.NewReader(file)
-
-	result := make([]Shop, 0, 10000)
-	for index := 0; ; index++ {
-		row, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			panic(err)
-		}
-
-		if index == 0 {
-			continue
-		}
-
-		id, err := strconv.ParseInt(row[0], 10, 64)
-		if err != nil {
-			panic(err)
-		}
-
-		lat, err := strconv.ParseFloat(row[1], 64)
-		if err != nil {
-			panic(err)
-		}
-
-		lon, err := strconv.ParseFloat(row[2], 64)
-		if err != nil {
-			panic(err)
-		}
-
-		result = append(result, Shop{
-			ID: id,
-			Location: Location{
-				Lat: lat,
-				Lon: lon,
-			},
-		})
-	}
-
-	return result
-}
-
-func batchShops(shops []Shop, batchSize int, fn func(shops []Shop) error) error {
-	for len(shops) > 0 {
-		n := batchSize
-		if n > len(shops) {
-			n = len(shops)
-		}
-
-		if err := fn(shops[:n]); err != nil {
-			return err
-		}
-		shops = shops[n:]
-	}
-	return nil
-}
-
 func buildBulkRequestBody(writer io.Writer, shops []Shop) {
 	type indexAction struct {
 		ID string `json:"_id"`
@@ -158,139 +88,6 @@ func buildBulkRequestBody(writer io.Writer, shops []Shop) {
 
 const indexName = "bench_shops"
 
-func indexData(client *elasticsearch.Client, shops []Shop) {
-	err := batchShops(shops, 1000, func(shops []Shop) error {
-		start := time.Now()
-		var buf bytes.Buffer
-		buildBulkRequestBody(&buf, shops)
-
-		resp, err := client.Bulk(&buf, client.Bulk.WithIndex(indexName))
-		if err != nil {
-			return err
-		}
-		defer func() { _ = resp.Body.Close() }()
-
-		if resp.IsError() || resp.StatusCode != http.StatusOK {
-			data, err := io.ReadAll(resp.Body)
-			fmt.Println(string(data), err)
-			panic(string(data))
-		}
-
-		fmt.Println("DURATION:", time.Since(start), len(shops))
-
-		return nil
-	})
-	if err != nil {
-		panic(err)
-	}
-}
-
-func writeDataToDB(db *sqlx.DB, shops []Shop) {
-	err := batchShops(shops, 1000, func(shops []Shop) error {
-		start := time.Now()
-
-		query := `
-INSERT INTO shops (id, lat, lon, geohash)
-VALUES (:id, :lat, :lon, :geohash)
-`
-		_, err := db.NamedExec(query, shopsToModels(shops))
-		if err != nil {
-			panic(err)
-		}
-
-		fmt.Println("DURATION:", time.Since(start), len(shops))
-		return nil
-	})
-	if err != nil {
-		panic(err)
-	}
-}
-
-func writeDataToMemcached(db *sqlx.DB, client *memcache.Client) {
-	var result []ShopModel
-	err := db.Select(&result, `SELECT id, lat, lon, geohash FROM shops`)
-	if err != nil {
-		panic(err)
-	}
-
-	shopMap := map[string][]ShopModel{}
-	for _, s := range result {
-		shopMap[s.Geohash] = append(shopMap[s.Geohash], s)
-	}
-
-	p := client.Pipeline()
-	defer p.Finish()
-
-	for k, v := range shopMap {
-		pbShops := make([]*pb.Shop, 0, len(v))
-		for _, s := range v {
-			pbShops = append(pbShops, &pb.Shop{
-				Id:  s.ID,
-				Lat: s.Lat,
-				Lon: s.Lon,
-			})
-		}
-
-		entry := &pb.ShopEntry{
-			Shops: pbShops,
-		}
-
-		data, err := proto.Marshal(entry)
-		if err != nil {
-			panic(err)
-		}
-		p.MSet(k, data, memcache.MSetOptions{})
-	}
-}
-
-var durationMut sync.Mutex
-var durations []time.Duration
-
-func searchWithES(client *elasticsearch.Client) {
-	lat := randLat()
-
-	var buf bytes.Buffer
-	buf.WriteString(fmt.Sprintf(`
-{
-    "query": {
-        "bool": {
-            "filter": [
-                {
-                    "geo_distance": {
-                        "distance": "0.5km",
-                        "location": {
-                            "lat": %v,
-                            "lon": 105.827342
-                        }
-                    }
-                }
-            ]
-        }
-    },
-    "size": 20
-}
-`, lat))
-
-	start := time.Now()
-
-	resp, err := client.Search(client.Search.WithIndex(indexName), client.Search.WithBody(&buf))
-	if err != nil {
-		fmt.Println("ERROR:", err)
-		return
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.IsError() {
-		data, _ := io.ReadAll(resp.Body)
-		panic(string(data))
-	}
-
-	d := time.Since(start)
-	durationMut.Lock()
-	durations = append(durations, d)
-	durationMut.Unlock()
-}
-
 func getESClient(maxConnsPerHost int) (*elasticsearch.Client, func()) {
 	dialer := &net.Dialer{
 		Timeout:   30 * time.Second,
@@ -320,311 +117,260 @@ func getESClient(maxConnsPerHost int) (*elasticsearch.Client, func()) {
 	return client, func() { transport.CloseIdleConnections() }
 }
 
-func doSearchESByLoc() {
-	const maxConnsPerHost = 10
-
-	client, deferFn := getESClient(maxConnsPerHost)
-	defer deferFn()
-
-	const numThreads = 100
-	const numLoops = 100
+var memcacheAddrs = []string{"localhost:11211"}
 
-	start := time.Now()
+var backendNames = []string{"es", "mysql", "mysql_spatial", "memcache", "grid", "kdtree", "brute_force"}
 
-	var wg sync.WaitGroup
-	wg.Add(numThreads)
+const mysqlDSN = "root:1@tcp(localhost:3306)/bench?parseTime=true"
 
-	for th := 0; th < numThreads; th++ {
-		go func() {
-			defer wg.Done()
-
-			for i := 0; i < numLoops; i++ {
-				searchWithES(client)
-			}
-		}()
+// connectMySQL creates the shops tables if not existed
+func connectMySQL() *sqlx.DB {
+	db := sqlx.MustConnect("mysql", mysqlDSN)
+	if err := caching.ApplySchema(context.Background(), db); err != nil {
+		panic(err)
 	}
+	return db
+}
 
-	wg.Wait()
-
-	sort.Slice(durations, func(i, j int) bool {
-		return durations[i] < durations[j]
-	})
-
-	printPercentile := func(p float64) {
-		index := int(p / 100 * float64(len(durations)))
-		fmt.Printf("Percentile %f: %v\n", p, durations[index])
+func parsePrecisions(list string) []uint32 {
+	var result []uint32
+	for _, s := range strings.Split(list, ",") {
+		p, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			panic(err)
+		}
+		if p < minPrecision || p > maxPrecision {
+			panic(fmt.Sprintf("precision %d out of range [%d, %d]", p, minPrecision, maxPrecision))
+		}
+		result = append(result, uint32(p))
 	}
+	return result
+}
 
-	fmt.Println("=========================================")
+func parseRadii(list string) []float64 {
+	var result []float64
+	for _, s := range strings.Split(list, ",") {
+		r, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, r)
+	}
+	return result
+}
 
-	printPercentile(50)
-	printPercentile(90)
-	printPercentile(95)
-	printPercentile(99)
-	printPercentile(99.9)
-
-	fmt.Println("MAX CONNS PER HOST:", maxConnsPerHost)
-	fmt.Println("Num Threads:", numThreads)
-	fmt.Println("TOTAL Requests:", numThreads*numLoops)
-	d := time.Since(start)
-	fmt.Println("TOTAL Duration:", d)
-	fmt.Println("AVG QPS:", float64(numThreads*numLoops)/d.Seconds())
+// isInMemory backends are always loaded from the shops file
+func isInMemory(b GeoBackend) bool {
+	switch b.(type) {
+	case *gridBackend, *kdTreeBackend, *bruteForceBackend:
+		return true
+	default:
+		return false
+	}
 }
 
-func searchWithDB(db *sqlx.DB) {
-	const radius = 0.5
+func newBackend(name string, memcachePrecisions []uint32, maxBucketShops int) (GeoBackend, func()) {
+	switch name {
+	case "es":
+		client, closeFn := getESClient(10)
+		return newESBackend(client), closeFn
 
-	start := time.Now()
+	case "mysql":
+		db := connectMySQL()
+		return newMySQLGeohashBackend(db, 100), func() { _ = db.Close() }
 
-	lat := randLat()
+	case "mysql_spatial":
+		db := connectMySQL()
+		return newMySQLSpatialBackend(db, 100), func() { _ = db.Close() }
 
-	hashList := geohash.NearbyGeohashList(geohash.Pos{
-		Lat: lat,
-		Lon: 105.827342,
-	}, radius, precision)
+	case "memcache":
+		client := newMemcacheCluster(memcacheAddrs, 32)
+		b := newMemcacheGeohashBackend(client, memcachePrecisions...)
+		b.maxBucketShops = maxBucketShops
+		return b, func() { _ = client.Close() }
 
-	hashes := make([]string, 0, len(hashList))
-	for _, h := range hashList {
-		hashes = append(hashes, h.String())
-	}
+	case "grid":
+		return newGridBackend(memcachePrecisions...), func() {}
 
-	query := `
-SELECT id, lat, lon, geohash
-FROM shops WHERE geohash IN (?)
-`
+	case "kdtree":
+		return newKDTreeBackend(), func() {}
 
-	query, args, err := sqlx.In(query, hashes)
-	if err != nil {
-		panic(err)
+	case "brute_force":
+		return newBruteForceBackend(), func() {}
+
+	default:
+		panic(fmt.Sprintf("unknown backend %q, expected one of %v", name, backendNames))
 	}
+}
 
-	var result []ShopModel
-	err = db.Select(&result, query, args...)
+// mustPointGenerator is for the modes holding all shops in memory
+func mustPointGenerator(name string, shops []Shop) PointGenerator {
+	points, err := newPointGenerator(name, func() ([]Location, error) {
+		return locationsOf(shops), nil
+	})
 	if err != nil {
 		panic(err)
 	}
+	return points
+}
 
-	count := 0
-	for _, s := range result {
-		pos1 := haversine.Pos{
-			Lat: lat,
-			Lon: 105.827342,
+func main() {
+	shopsFile := flag.String("shops", "shops.csv", "shops csv file")
+	backendList := flag.String("backend", "memcache", fmt.Sprintf("comma separated backends, of %v", backendNames))
+	load := flag.Bool("load", false, "load the shops file into the backends before searching, "+
+		"the mysql shops table must be truncated and reloaded if it was loaded with 6 character geohashes")
+	checkDuplicates := flag.Bool("check-duplicates", true, "reject rows with an id already loaded, keeps every id in memory")
+	pointsName := flag.String("points", "uniform", fmt.Sprintf("query point generator, one of %v", pointGeneratorNames))
+	queryName := flag.String("query", "nearby", "nearby, nearest, box or polygon")
+	radius := flag.Float64("radius", 0.5, "search radius in km of nearby")
+	numNearest := flag.Int("n", 10, "number of shops of nearest")
+	areaKm := flag.Float64("area-km", 1, "side of the box, radius of the polygon, in km")
+	numThreads := flag.Int("threads", 100, "number of concurrent goroutines")
+	numLoops := flag.Int("loops", 100, "requests per goroutine")
+	precisionList := flag.String("precisions", "6", "comma separated precisions of the memcache and grid buckets")
+	sweepRadii := flag.String("sweep", "", "comma separated radii, rebuild the memcache buckets at precisions 4-8 and search each radius, instead of benchmarking")
+	moveShops := flag.Int("move", 0, "move this many shops around one query point concurrently with CAS, instead of benchmarking searches")
+	moveKm := flag.Float64("move-km", 0.2, "distance in km of a move")
+	maxBucket := flag.Int("max-bucket", 0, "split the memcache buckets with more shops into the next precision, 0 = never split")
+	bucketStats := flag.Bool("bucket-stats", false, "print the memcache bucket sizes of the shops file without and with -max-bucket, instead of benchmarking")
+	verifyPoints := flag.Int("verify", 0, "compare backends with a brute force scan of the shops file on this many points, instead of benchmarking")
+	flag.Parse()
+
+	if *queryName == "nearest" && *numNearest < 1 {
+		panic(fmt.Sprintf("-n must be at least 1, got %d", *numNearest))
+	}
+
+	if *bucketStats {
+		shops, err := readShops(*shopsFile)
+		if err != nil {
+			panic(err)
 		}
-		pos2 := haversine.Pos{
-			Lat: s.Lat,
-			Lon: s.Lon,
+
+		// only the layout is computed, nothing is written
+		b := newMemcacheGeohashBackend(nil, parsePrecisions(*precisionList)...)
+		for _, stats := range b.bucketStats(shops, 10) {
+			stats.Print()
 		}
-		d := haversine.DistanceEarth(pos1, pos2)
-		if d <= radius {
-			count++
+		if *maxBucket > 0 {
+			b.maxBucketShops = *maxBucket
+			for _, stats := range b.bucketStats(shops, 10) {
+				stats.Print()
+			}
 		}
+		return
 	}
 
-	d := time.Since(start)
-	durationMut.Lock()
-	durations = append(durations, d)
-	durationMut.Unlock()
-}
-
-func randFloat64(a, b float64) float64 {
-	return rand.Float64()*(b-a) + a
-}
-
-func randLat() float64 {
-	return randFloat64(20.920967, 21.020967)
-}
-
-func searchWithMemcache(client *memcache.Client) {
-	const radius = 0.5
-
-	start := time.Now()
-
-	lat := randLat()
-
-	hashList := geohash.NearbyGeohashList(geohash.Pos{
-		Lat: lat,
-		Lon: 105.827342,
-	}, radius, precision)
-
-	respList := make([]func() (memcache.MGetResponse, error), 0, len(hashList))
-
-	p := client.Pipeline()
-	defer p.Finish()
-
-	for _, h := range hashList {
-		fn := p.MGet(h.String(), memcache.MGetOptions{})
-		respList = append(respList, fn)
-	}
-
-	result := make([]ShopModel, 0, 100)
-	for _, fn := range respList {
-		resp, err := fn()
+	if *sweepRadii != "" {
+		shops, err := readShops(*shopsFile)
 		if err != nil {
 			panic(err)
 		}
-		if resp.Type != memcache.MGetResponseTypeVA {
-			continue
-		}
+		points := mustPointGenerator(*pointsName, shops)
 
-		var entry pb.ShopEntry
-		err = proto.Unmarshal(resp.Data, &entry)
+		client := newMemcacheCluster(memcacheAddrs, 32)
+		defer func() { _ = client.Close() }()
 
+		rows, err := runPrecisionSweep(client, shops, points, parseRadii(*sweepRadii), *numLoops, *numThreads)
 		if err != nil {
 			panic(err)
 		}
-
-		modelList := make([]ShopModel, 0, len(entry.Shops))
-		for _, s := range entry.Shops {
-			modelList = append(modelList, ShopModel{
-				ID:  s.Id,
-				Lat: s.Lat,
-				Lon: s.Lon,
-			})
-		}
-		result = append(result, modelList...)
+		printPrecisionSweep(rows)
+		return
 	}
 
-	count := 0
-	for _, s := range result {
-		pos1 := haversine.Pos{
-			Lat: lat,
-			Lon: 105.827342,
-		}
-		pos2 := haversine.Pos{
-			Lat: s.Lat,
-			Lon: s.Lon,
-		}
-		d := haversine.DistanceEarth(pos1, pos2)
-		if d <= radius {
-			count++
+	if *moveShops > 0 {
+		shops, err := readShops(*shopsFile)
+		if err != nil {
+			panic(err)
 		}
-	}
-
-	d := time.Since(start)
-	durationMut.Lock()
-	durations = append(durations, d)
-	durationMut.Unlock()
-}
-
-func doSearchUsingDB(db *sqlx.DB) {
-	const numConns = 100
+		points := mustPointGenerator(*pointsName, shops)
 
-	db.SetMaxOpenConns(numConns)
-	db.SetMaxIdleConns(numConns)
+		// the closest shops share few buckets, the most conflicts
+		all := newBruteForceBackend()
+		_ = all.Load(shops)
+		center := points.Next()
+		hot, _ := all.Nearest(center.Lat, center.Lon, *moveShops)
 
-	const numThreads = 100
-	const numLoops = 100
+		client := newMemcacheCluster(memcacheAddrs, 32)
+		defer func() { _ = client.Close() }()
 
-	start := time.Now()
-
-	var wg sync.WaitGroup
-	wg.Add(numThreads)
-
-	for th := 0; th < numThreads; th++ {
-		go func() {
-			defer wg.Done()
+		b := newMemcacheGeohashBackend(client, parsePrecisions(*precisionList)...)
+		b.maxBucketShops = *maxBucket
+		if _, err := b.rebuild(shops); err != nil {
+			panic(err)
+		}
 
-			for i := 0; i < numLoops; i++ {
-				searchWithDB(db)
-			}
-		}()
+		result, _ := runUpdateBench(b, hot, *moveKm, *numLoops, *numThreads)
+		result.Print()
+		return
 	}
 
-	wg.Wait()
-
-	sort.Slice(durations, func(i, j int) bool {
-		return durations[i] < durations[j]
+	// the file is read again only by the generators sampling from the shops
+	points, err := newPointGenerator(*pointsName, func() ([]Location, error) {
+		return readShopLocations(*shopsFile)
 	})
-
-	printPercentile := func(p float64) {
-		index := int(p / 100 * float64(len(durations)))
-		if index >= len(durations) {
-			index = len(durations) - 1
-		}
-		fmt.Printf("Percentile %f: %v\n", p, durations[index])
+	if err != nil {
+		panic(err)
 	}
 
-	fmt.Println("=========================================")
-	fmt.Println("Search With Database")
-
-	printPercentile(50)
-	printPercentile(90)
-	printPercentile(95)
-	printPercentile(99)
-	printPercentile(99.9)
-
-	fmt.Println("MAX CONNS:", numConns)
-	fmt.Println("Num Threads:", numThreads)
-	fmt.Println("TOTAL Requests:", numThreads*numLoops)
-	d := time.Since(start)
-	fmt.Println("TOTAL Duration:", d)
-	fmt.Println("AVG QPS:", float64(numThreads*numLoops)/d.Seconds())
-}
-
-func doSearchUsingMemcache(client *memcache.Client) {
-	const numThreads = 100
-	const numLoops = 5000
-
-	start := time.Now()
-
-	var wg sync.WaitGroup
-	wg.Add(numThreads)
-
-	for th := 0; th < numThreads; th++ {
-		go func() {
-			defer wg.Done()
-
-			for i := 0; i < numLoops; i++ {
-				searchWithMemcache(client)
-			}
-		}()
+	var backends []GeoBackend
+	for _, name := range strings.Split(*backendList, ",") {
+		b, closeFn := newBackend(name, parsePrecisions(*precisionList), *maxBucket)
+		defer closeFn()
+		backends = append(backends, b)
 	}
 
-	wg.Wait()
-
-	sort.Slice(durations, func(i, j int) bool {
-		return durations[i] < durations[j]
-	})
-
-	printPercentile := func(p float64) {
-		index := int(p / 100 * float64(len(durations)))
-		if index >= len(durations) {
-			index = len(durations) - 1
+	var writers []shopWriter
+	for _, b := range backends {
+		if *load || isInMemory(b) {
+			writers = append(writers, backendWriter(b))
+		}
+	}
+	if len(writers) > 0 {
+		report, err := loadShops(*shopsFile, 1000, -1, *checkDuplicates, writers...)
+		report.Print()
+		if err != nil {
+			panic(err)
 		}
-		fmt.Printf("Percentile %f: %v\n", p, durations[index])
 	}
 
-	fmt.Println("=========================================")
-	fmt.Println("Search With Memcache")
-
-	printPercentile(50)
-	printPercentile(90)
-	printPercentile(95)
-	printPercentile(99)
-	printPercentile(99.9)
-
-	fmt.Println("Num Threads:", numThreads)
-	fmt.Println("TOTAL Requests:", numThreads*numLoops)
-	d := time.Since(start)
-	fmt.Println("TOTAL Duration:", d)
-	fmt.Println("AVG QPS:", float64(numThreads*numLoops)/d.Seconds())
-}
-
-func main() {
-	//shops := loadShops("shops.csv")
-	//indexData(client, shops)
-	//doSearchESByLoc()
+	var query GeoQuery
+	switch *queryName {
+	case "nearby":
+		query = nearbyQuery(*radius)
+	case "nearest":
+		query = nearestQuery(*numNearest)
+	case "box":
+		query = boxQuery(*areaKm / 2)
+	case "polygon":
+		query = polygonQuery(*areaKm)
+	default:
+		panic(fmt.Sprintf("unknown query %q", *queryName))
+	}
 
-	//db := sqlx.MustConnect("mysql", "root:1@tcp(localhost:3306)/bench?parseTime=true")
+	if *verifyPoints > 0 {
+		reference := newBruteForceBackend()
+		if _, err := loadShops(*shopsFile, 1000, -1, *checkDuplicates, backendWriter(reference)); err != nil {
+			panic(err)
+		}
 
-	client, err := memcache.New("localhost:11211", 32)
-	if err != nil {
-		panic(err)
+		reports, err := verifyBackends(reference, backends, query, points, *verifyPoints)
+		if err != nil {
+			panic(err)
+		}
+		for _, r := range reports {
+			r.Print(20)
+		}
+		return
 	}
 
-	//writeDataToDB(db, shops)
-	//writeDataToMemcached(db, client)
+	results := make([]GeoBenchResult, 0, len(backends))
+	for _, b := range backends {
+		r := runGeoBench(b, query, points, *numLoops, *numThreads)
+		r.Print()
+		results = append(results, r)
+	}
 
-	//doSearchUsingDB(db)
-	doSearchUsingMemcache(client)
+	fmt.Println("=========================================")
+	printGeoBenchTable(results)
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"github.com/QuangTung97/go-memcache/memcache"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -34,16 +33,9 @@ func TestBuildBulkRequestBody(t *testing.T) {
 
 func BenchmarkGetFromMemcache(b *testing.B) {
 	for n := 0; n < b.N; n++ {
-		client, err := memcache.New("localhost:11211", 16)
-		if err != nil {
-			panic(err)
-		}
+		client := newMemcacheCluster(memcacheAddrs, 16)
 
-		//writeDataToDB(db, shops)
-		//writeDataToMemcached(db, client)
-
-		//doSearchUsingDB(db)
-		doSearchUsingMemcache(client)
+		runGeoBench(newMemcacheGeohashBackend(client), nearbyQuery(0.5), linePoints{}, 5000, 100).Print()
 
 		_ = client.Close()
 	}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bench_elastic/util"
+	"fmt"
+	"github.com/QuangTung97/go-memcache/memcache"
+	"sync/atomic"
+)
+
+// memcacheCluster routes keys to memcache servers by consistent hashing
+type memcacheCluster struct {
+	ring    *util.HashRing[string]
+	clients map[string]*memcache.Client
+	metrics map[string]*nodeMetrics
+}
+
+type nodeMetrics struct {
+	gets atomic.Int64
+	sets atomic.Int64
+}
+
+func newMemcacheCluster(addrs []string, numConns int) *memcacheCluster {
+	clients := map[string]*memcache.Client{}
+	metrics := map[string]*nodeMetrics{}
+
+	for _, addr := range addrs {
+		client, err := memcache.New(addr, numConns)
+		if err != nil {
+			panic(err)
+		}
+		clients[addr] = client
+		metrics[addr] = &nodeMetrics{}
+	}
+
+	return &memcacheCluster{
+		ring: util.NewHashRing(addrs, 160, func(addr string) string {
+			return addr
+		}),
+		clients: clients,
+		metrics: metrics,
+	}
+}
+
+func (c *memcacheCluster) Close() error {
+	var lastErr error
+	for _, client := range c.clients {
+		if err := client.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (c *memcacheCluster) printNodeMetrics() {
+	for _, addr := range c.ring.Nodes() {
+		m := c.metrics[addr]
+		fmt.Printf("NODE %s: GETS: %d, SETS: %d\n", addr, m.gets.Load(), m.sets.Load())
+	}
+}
+
+// clusterPipeline is NOT thread safe
+type clusterPipeline struct {
+	cluster   *memcacheCluster
+	pipelines map[string]*memcache.Pipeline
+}
+
+func (c *memcacheCluster) Pipeline() *clusterPipeline {
+	return &clusterPipeline{
+		cluster:   c,
+		pipelines: map[string]*memcache.Pipeline{},
+	}
+}
+
+func (p *clusterPipeline) getPipeline(key string) (string, *memcache.Pipeline) {
+	addr := p.cluster.ring.Get(key)
+	pipe, ok := p.pipelines[addr]
+	if !ok {
+		pipe = p.cluster.clients[addr].Pipeline()
+		p.pipelines[addr] = pipe
+	}
+	return addr, pipe
+}
+
+// execute flushes commands of all servers, so that waiting on one server does not delay the others
+func (p *clusterPipeline) execute() {
+	for _, pipe := range p.pipelines {
+		pipe.Execute()
+	}
+}
+
+func (p *clusterPipeline) MGet(key string, options memcache.MGetOptions) func() (memcache.MGetResponse, error) {
+	addr, pipe := p.getPipeline(key)
+	p.cluster.metrics[addr].gets.Add(1)
+
+	fn := pipe.MGet(key, options)
+	return func() (memcache.MGetResponse, error) {
+		p.execute()
+		return fn()
+	}
+}
+
+func (p *clusterPipeline) MSet(key string, data []byte, options memcache.MSetOptions) func() (memcache.MSetResponse, error) {
+	addr, pipe := p.getPipeline(key)
+	p.cluster.metrics[addr].sets.Add(1)
+
+	fn := pipe.MSet(key, data, options)
+	return func() (memcache.MSetResponse, error) {
+		p.execute()
+		return fn()
+	}
+}
+
+func (p *clusterPipeline) Finish() {
+	for _, pipe := range p.pipelines {
+		pipe.Finish()
+	}
+}
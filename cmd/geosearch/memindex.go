@@ -0,0 +1,278 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"sync"
+)
+
+// ===============================================
+// Geohash grid
+// ===============================================
+
+// gridBackend is the memcache bucket layout held in a map, the same algorithm without the network
+type gridBackend struct {
+	precisions []uint32
+	cells      map[string][]ShopModel
+}
+
+func newGridBackend(precisions ...uint32) *gridBackend {
+	if len(precisions) == 0 {
+		precisions = []uint32{precision}
+	}
+	return &gridBackend{
+		precisions: precisions,
+		cells:      map[string][]ShopModel{},
+	}
+}
+
+func (*gridBackend) Name() string {
+	return "grid"
+}
+
+// Load is NOT thread safe, it must be done before any search
+func (b *gridBackend) Load(shops []Shop) error {
+	for _, p := range b.precisions {
+		for _, m := range shopsToModels(shops, p) {
+			b.cells[m.Geohash] = append(b.cells[m.Geohash], m)
+		}
+	}
+	return nil
+}
+
+func (b *gridBackend) fetchCells(hashes []string) ([]ShopModel, error) {
+	var result []ShopModel
+	for _, h := range hashes {
+		result = append(result, b.cells[h]...)
+	}
+	return result, nil
+}
+
+func (b *gridBackend) Nearby(lat, lon, radius float64) ([]Shop, error) {
+	p := choosePrecision(radius, lat, defaultMaxCells, b.precisions)
+
+	result, _ := b.fetchCells(nearbyHashes(lat, lon, radius, p))
+	return filterWithinRadius(Location{Lat: lat, Lon: lon}, result, radius), nil
+}
+
+func (b *gridBackend) Nearest(lat, lon float64, n int) ([]Shop, error) {
+	p := closestPrecision(precision, b.precisions)
+	return nearestByRings(Location{Lat: lat, Lon: lon}, n, p, b.fetchCells)
+}
+
+func (b *gridBackend) InBox(box BoundingBox) ([]Shop, error) {
+	return inBoxByCells(box, b.precisions, b.fetchCells)
+}
+
+func (b *gridBackend) InPolygon(polygon []Location) ([]Shop, error) {
+	return inPolygonByCells(polygon, b.precisions, b.fetchCells)
+}
+
+// ===============================================
+// KD-tree
+// ===============================================
+
+// earthRadiusKm is the radius used by haversine.DistanceEarth
+const earthRadiusKm = 6371.009
+
+// kdTreeBackend is an implicit 2-d tree: the median of a range is its root, the axis alternates lat / lon.
+// The tree is built on the first search, Load must be done before it
+type kdTreeBackend struct {
+	shops []Shop
+	once  sync.Once
+}
+
+func newKDTreeBackend() *kdTreeBackend {
+	return &kdTreeBackend{}
+}
+
+func (*kdTreeBackend) Name() string {
+	return "kdtree"
+}
+
+func (b *kdTreeBackend) Load(shops []Shop) error {
+	b.shops = append(b.shops, shops...)
+	return nil
+}
+
+func (b *kdTreeBackend) tree() []Shop {
+	b.once.Do(func() {
+		buildKDTree(b.shops, 0)
+	})
+	return b.shops
+}
+
+func axisValue(l Location, depth int) float64 {
+	if depth%2 == 0 {
+		return l.Lat
+	}
+	return l.Lon
+}
+
+func buildKDTree(shops []Shop, depth int) {
+	if len(shops) <= 1 {
+		return
+	}
+	sort.Slice(shops, func(i, j int) bool {
+		return axisValue(shops[i].Location, depth) < axisValue(shops[j].Location, depth)
+	})
+
+	mid := len(shops) / 2
+	buildKDTree(shops[:mid], depth+1)
+	buildKDTree(shops[mid+1:], depth+1)
+}
+
+// planeDistance is a lower bound of the distance from origin to any location on the other side
+// of the split line of node: a parallel for lat, a meridian for lon
+func planeDistance(origin Location, node Location, depth int) float64 {
+	if depth%2 == 0 {
+		return distanceKm(origin, Location{Lat: node.Lat, Lon: origin.Lon})
+	}
+
+	dLon := math.Min(math.Abs(origin.Lon-node.Lon), 90) * math.Pi / 180
+	return earthRadiusKm * math.Asin(math.Cos(origin.Lat*math.Pi/180)*math.Sin(dLon))
+}
+
+// kdChildren returns the side of origin first
+func kdChildren(shops []Shop, origin Location, depth int) ([]Shop, []Shop) {
+	mid := len(shops) / 2
+	if axisValue(origin, depth) < axisValue(shops[mid].Location, depth) {
+		return shops[:mid], shops[mid+1:]
+	}
+	return shops[mid+1:], shops[:mid]
+}
+
+func kdNearby(shops []Shop, depth int, origin Location, radius float64, result *[]Shop) {
+	if len(shops) == 0 {
+		return
+	}
+
+	node := shops[len(shops)/2]
+	if distanceKm(origin, node.Location) <= radius {
+		*result = append(*result, node)
+	}
+
+	near, far := kdChildren(shops, origin, depth)
+	kdNearby(near, depth+1, origin, radius, result)
+	if planeDistance(origin, node.Location, depth) <= radius {
+		kdNearby(far, depth+1, origin, radius, result)
+	}
+}
+
+type shopDistance struct {
+	shop Shop
+	dist float64
+}
+
+func (a shopDistance) farther(b shopDistance) bool {
+	if a.dist != b.dist {
+		return a.dist > b.dist
+	}
+	return a.shop.ID > b.shop.ID
+}
+
+// farthestFirst is a max heap of the best candidates, the root is the worst of them
+type farthestFirst []shopDistance
+
+func (h farthestFirst) Len() int           { return len(h) }
+func (h farthestFirst) Less(i, j int) bool { return h[i].farther(h[j]) }
+func (h farthestFirst) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *farthestFirst) Push(x interface{}) {
+	*h = append(*h, x.(shopDistance))
+}
+
+func (h *farthestFirst) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func kdNearest(shops []Shop, depth int, origin Location, n int, best *farthestFirst) {
+	if len(shops) == 0 {
+		return
+	}
+
+	node := shops[len(shops)/2]
+	candidate := shopDistance{shop: node, dist: distanceKm(origin, node.Location)}
+	if best.Len() < n {
+		heap.Push(best, candidate)
+	} else if (*best)[0].farther(candidate) {
+		(*best)[0] = candidate
+		heap.Fix(best, 0)
+	}
+
+	near, far := kdChildren(shops, origin, depth)
+	kdNearest(near, depth+1, origin, n, best)
+	if best.Len() < n || planeDistance(origin, node.Location, depth) <= (*best)[0].dist {
+		kdNearest(far, depth+1, origin, n, best)
+	}
+}
+
+func (b *kdTreeBackend) Nearby(lat, lon, radius float64) ([]Shop, error) {
+	var result []Shop
+	kdNearby(b.tree(), 0, Location{Lat: lat, Lon: lon}, radius, &result)
+	return result, nil
+}
+
+func (b *kdTreeBackend) Nearest(lat, lon float64, n int) ([]Shop, error) {
+	if n < 1 {
+		return nil, nil
+	}
+	origin := Location{Lat: lat, Lon: lon}
+
+	best := make(farthestFirst, 0, n)
+	kdNearest(b.tree(), 0, origin, n, &best)
+
+	result := make([]Shop, 0, len(best))
+	for _, c := range best {
+		result = append(result, c.shop)
+	}
+	sortByDistance(origin, result)
+	return result, nil
+}
+
+func kdInBox(shops []Shop, depth int, box BoundingBox, result *[]Shop) {
+	if len(shops) == 0 {
+		return
+	}
+
+	mid := len(shops) / 2
+	node := shops[mid]
+	if box.contains(node.Location) {
+		*result = append(*result, node)
+	}
+
+	lo, hi := box.MinLat, box.MaxLat
+	if depth%2 == 1 {
+		lo, hi = box.MinLon, box.MaxLon
+	}
+	v := axisValue(node.Location, depth)
+	if lo <= v {
+		kdInBox(shops[:mid], depth+1, box, result)
+	}
+	if v <= hi {
+		kdInBox(shops[mid+1:], depth+1, box, result)
+	}
+}
+
+func (b *kdTreeBackend) InBox(box BoundingBox) ([]Shop, error) {
+	var result []Shop
+	kdInBox(b.tree(), 0, box, &result)
+	return result, nil
+}
+
+func (b *kdTreeBackend) InPolygon(polygon []Location) ([]Shop, error) {
+	var candidates []Shop
+	kdInBox(b.tree(), 0, boundingBoxOf(polygon), &candidates)
+
+	result := candidates[:0]
+	for _, s := range candidates {
+		if pointInPolygon(s.Location, polygon) {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestInMemoryBackends__Same_As_Brute_Force(t *testing.T) {
+	rand.Seed(4321)
+
+	box := BoundingBox{MinLat: 20.9, MaxLat: 21.1, MinLon: 105.7, MaxLon: 105.9}
+	var shops []Shop
+	for _, m := range randomShopModels(3000, box) {
+		shops = append(shops, m.toShop())
+	}
+
+	reference := newBruteForceBackend()
+	grid := newGridBackend(5, 6, 7)
+	kdTree := newKDTreeBackend()
+	for _, b := range []GeoBackend{reference, grid, kdTree} {
+		assert.Equal(t, nil, b.Load(shops))
+	}
+
+	queries := []GeoQuery{
+		nearbyQuery(0.1),
+		nearbyQuery(0.5),
+		nearbyQuery(3),
+		nearestQuery(1),
+		nearestQuery(20),
+		boxQuery(0.3),
+		boxQuery(2),
+		polygonQuery(1),
+	}
+	for _, query := range queries {
+		reports, err := verifyBackends(reference, []GeoBackend{grid, kdTree}, query, newUniformPoints(box), 200)
+		assert.Equal(t, nil, err)
+
+		for _, r := range reports {
+			assert.Equal(t, 0, len(r.Mismatches), r.Backend+" "+query.Name)
+			assert.Equal(t, int64(0), r.BoundaryTies, r.Backend+" "+query.Name)
+		}
+	}
+}
+
+func TestKDTreeBackend_Nearest__Sorted(t *testing.T) {
+	b := newKDTreeBackend()
+	_ = b.Load([]Shop{
+		{ID: 1, Location: Location{Lat: 21.003, Lon: 105.8}},
+		{ID: 2, Location: Location{Lat: 21.001, Lon: 105.8}},
+		{ID: 3, Location: Location{Lat: 21.002, Lon: 105.8}},
+		{ID: 4, Location: Location{Lat: 21.0, Lon: 105.801}},
+	})
+
+	result, err := b.Nearest(21.0, 105.8, 3)
+	assert.Equal(t, nil, err)
+
+	ids := make([]int64, 0, len(result))
+	for _, s := range result {
+		ids = append(ids, s.ID)
+	}
+	assert.Equal(t, []int64{4, 2, 3}, ids)
+}
+
+func TestPlaneDistance__Lower_Bound(t *testing.T) {
+	rand.Seed(99)
+
+	for i := 0; i < 10000; i++ {
+		origin := Location{Lat: randFloat64(-60, 60), Lon: randFloat64(-170, 170)}
+		node := Location{Lat: origin.Lat + randFloat64(-1, 1), Lon: origin.Lon + randFloat64(-1, 1)}
+		other := Location{Lat: origin.Lat + randFloat64(-2, 2), Lon: origin.Lon + randFloat64(-2, 2)}
+
+		for depth := 0; depth < 2; depth++ {
+			originSide := axisValue(origin, depth) < axisValue(node, depth)
+			otherSide := axisValue(other, depth) < axisValue(node, depth)
+			if originSide == otherSide {
+				continue
+			}
+			assert.LessOrEqual(t, planeDistance(origin, node, depth), distanceKm(origin, other)+1e-9)
+		}
+	}
+}
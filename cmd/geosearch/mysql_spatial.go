@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// sridAxisOrder makes WKT coordinates (lon lat) for SRID 4326, which is lat first by default in MySQL 8
+const sridAxisOrder = `4326, 'axis-order=long-lat'`
+
+// sphereRadiusMeters is the radius of haversine.DistanceEarth, for ST_Distance_Sphere
+const sphereRadiusMeters = earthRadiusKm * 1000
+
+// nearestStartKm is the first search radius of Nearest, doubled until n shops are certified
+const nearestStartKm = 0.5
+
+// mysqlSpatialBackend stores a POINT with a SPATIAL INDEX in the shops_spatial table of caching/init.sql
+type mysqlSpatialBackend struct {
+	db *sqlx.DB
+}
+
+func newMySQLSpatialBackend(db *sqlx.DB, numConns int) *mysqlSpatialBackend {
+	db.SetMaxOpenConns(numConns)
+	db.SetMaxIdleConns(numConns)
+	return &mysqlSpatialBackend{db: db}
+}
+
+func (*mysqlSpatialBackend) Name() string {
+	return "mysql_spatial"
+}
+
+func pointWKT(l Location) string {
+	return fmt.Sprintf("POINT(%v %v)", l.Lon, l.Lat)
+}
+
+func boxWKT(box BoundingBox) string {
+	return fmt.Sprintf("POLYGON((%v %v, %v %v, %v %v, %v %v, %v %v))",
+		box.MinLon, box.MinLat,
+		box.MaxLon, box.MinLat,
+		box.MaxLon, box.MaxLat,
+		box.MinLon, box.MaxLat,
+		box.MinLon, box.MinLat,
+	)
+}
+
+func (b *mysqlSpatialBackend) Load(shops []Shop) error {
+	var buf strings.Builder
+	buf.WriteString("INSERT INTO shops_spatial (id, location) VALUES ")
+
+	args := make([]interface{}, 0, 2*len(shops))
+	for i, s := range shops {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("(?, ST_GeomFromText(?, " + sridAxisOrder + "))")
+		args = append(args, s.ID, pointWKT(s.Location))
+	}
+
+	_, err := b.db.Exec(buf.String(), args...)
+	return err
+}
+
+type spatialRow struct {
+	ID       int64   `db:"id"`
+	Lat      float64 `db:"lat"`
+	Lon      float64 `db:"lon"`
+	Distance float64 `db:"distance"`
+}
+
+func (r spatialRow) toShop() Shop {
+	return Shop{
+		ID: r.ID,
+		Location: Location{
+			Lat: r.Lat,
+			Lon: r.Lon,
+		},
+	}
+}
+
+// selectInBox uses the spatial index through MBRContains, extra conditions are appended to it
+func (b *mysqlSpatialBackend) selectInBox(origin Location, box BoundingBox, extra string, extraArgs ...interface{}) ([]spatialRow, error) {
+	query := `
+SELECT id, ST_Latitude(location) AS lat, ST_Longitude(location) AS lon,
+    ST_Distance_Sphere(location, ST_GeomFromText(?, ` + sridAxisOrder + `), ?) / 1000 AS distance
+FROM shops_spatial
+WHERE MBRContains(ST_GeomFromText(?, ` + sridAxisOrder + `), location)
+` + extra
+
+	args := append([]interface{}{pointWKT(origin), sphereRadiusMeters, boxWKT(box)}, extraArgs...)
+
+	var rows []spatialRow
+	if err := b.db.Select(&rows, query, args...); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (b *mysqlSpatialBackend) Nearby(lat, lon, radius float64) ([]Shop, error) {
+	origin := Location{Lat: lat, Lon: lon}
+
+	rows, err := b.selectInBox(origin, boxAround(origin, radius), `HAVING distance <= ?`, radius)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Shop, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, r.toShop())
+	}
+	return result, nil
+}
+
+// Nearest searches boxes of increasing size, the n-th shop is certified when it is inside the circle of the box
+func (b *mysqlSpatialBackend) Nearest(lat, lon float64, n int) ([]Shop, error) {
+	if n < 1 {
+		return nil, nil
+	}
+	origin := Location{Lat: lat, Lon: lon}
+
+	var rows []spatialRow
+	for r := nearestStartKm; r <= kmPerDegree*180; r *= 2 {
+		var err error
+		rows, err = b.selectInBox(origin, boxAround(origin, r), `ORDER BY distance, id LIMIT ?`, n)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == n && rows[n-1].Distance <= r {
+			break
+		}
+	}
+
+	result := make([]Shop, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, r.toShop())
+	}
+	sortByDistance(origin, result)
+	return result, nil
+}
+
+func (b *mysqlSpatialBackend) InBox(box BoundingBox) ([]Shop, error) {
+	center := Location{Lat: (box.MinLat + box.MaxLat) / 2, Lon: (box.MinLon + box.MaxLon) / 2}
+
+	rows, err := b.selectInBox(center, box, "")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Shop, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, r.toShop())
+	}
+	return result, nil
+}
+
+// InPolygon filters in Go, ST_Contains on SRID 4326 uses geodesic edges instead of straight (lon, lat) lines
+func (b *mysqlSpatialBackend) InPolygon(polygon []Location) ([]Shop, error) {
+	candidates, err := b.InBox(boundingBoxOf(polygon))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Shop, 0, len(candidates))
+	for _, s := range candidates {
+		if pointInPolygon(s.Location, polygon) {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSpatialWKT(t *testing.T) {
+	assert.Equal(t, "POINT(105.8 21)", pointWKT(Location{Lat: 21, Lon: 105.8}))
+	assert.Equal(t,
+		"POLYGON((105.7 20.9, 105.9 20.9, 105.9 21.1, 105.7 21.1, 105.7 20.9))",
+		boxWKT(BoundingBox{MinLat: 20.9, MaxLat: 21.1, MinLon: 105.7, MaxLon: 105.9}),
+	)
+}
+
+func TestMySQLSpatialBackend_Nearest__Non_Positive_N(t *testing.T) {
+	// returns before any query
+	b := &mysqlSpatialBackend{}
+	for _, n := range []int{0, -1} {
+		result, err := b.Nearest(21.0, 105.8, n)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 0, len(result))
+	}
+}
+
+func TestMySQLSpatialBackend__Same_As_Geohash(t *testing.T) {
+	geo, closeGeo := newBackend("mysql", nil, 0)
+	defer closeGeo()
+
+	spatial, closeSpatial := newBackend("mysql_spatial", nil, 0)
+	defer closeSpatial()
+
+	for _, query := range []GeoQuery{nearbyQuery(0.5), nearestQuery(10), boxQuery(0.5)} {
+		reports, err := verifyBackends(geo, []GeoBackend{spatial}, query, linePoints{}, 100)
+		assert.Equal(t, nil, err)
+		reports[0].Print(10)
+		assert.Equal(t, 0, len(reports[0].Mismatches))
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/QuangTung97/geohash"
+)
+
+// PointGenerator produces the query locations of a benchmark, implementations are thread safe
+type PointGenerator interface {
+	Name() string
+	Next() Location
+}
+
+// BoundingBox ...
+type BoundingBox struct {
+	MinLat float64
+	MaxLat float64
+	MinLon float64
+	MaxLon float64
+}
+
+func boundingBoxOf(locations []Location) BoundingBox {
+	box := BoundingBox{
+		MinLat: math.Inf(1),
+		MaxLat: math.Inf(-1),
+		MinLon: math.Inf(1),
+		MaxLon: math.Inf(-1),
+	}
+	for _, l := range locations {
+		box.MinLat = math.Min(box.MinLat, l.Lat)
+		box.MaxLat = math.Max(box.MaxLat, l.Lat)
+		box.MinLon = math.Min(box.MinLon, l.Lon)
+		box.MaxLon = math.Max(box.MaxLon, l.Lon)
+	}
+	return box
+}
+
+func (b BoundingBox) contains(l Location) bool {
+	return l.Lat >= b.MinLat && l.Lat <= b.MaxLat && l.Lon >= b.MinLon && l.Lon <= b.MaxLon
+}
+
+func randFloat64(a, b float64) float64 {
+	return rand.Float64()*(b-a) + a
+}
+
+// linePoints is the original query distribution: a 0.1° north-south line through Hanoi
+type linePoints struct {
+}
+
+func (linePoints) Name() string {
+	return "line"
+}
+
+func (linePoints) Next() Location {
+	return Location{
+		Lat: randFloat64(20.920967, 21.020967),
+		Lon: 105.827342,
+	}
+}
+
+type uniformPoints struct {
+	box BoundingBox
+}
+
+func newUniformPoints(box BoundingBox) *uniformPoints {
+	return &uniformPoints{box: box}
+}
+
+func (*uniformPoints) Name() string {
+	return "uniform"
+}
+
+func (p *uniformPoints) Next() Location {
+	return Location{
+		Lat: randFloat64(p.box.MinLat, p.box.MaxLat),
+		Lon: randFloat64(p.box.MinLon, p.box.MaxLon),
+	}
+}
+
+const kmPerDegree = 111.32
+
+// nearShopPoints picks a random shop and moves it by a gaussian offset of sigma km in each direction
+type nearShopPoints struct {
+	shops   []Location
+	sigmaKm float64
+}
+
+func newNearShopPoints(shops []Location, sigmaKm float64) *nearShopPoints {
+	return &nearShopPoints{
+		shops:   shops,
+		sigmaKm: sigmaKm,
+	}
+}
+
+func (*nearShopPoints) Name() string {
+	return "near_shop"
+}
+
+func (p *nearShopPoints) Next() Location {
+	s := p.shops[rand.Intn(len(p.shops))]
+
+	dLat := rand.NormFloat64() * p.sigmaKm / kmPerDegree
+	dLon := rand.NormFloat64() * p.sigmaKm / (kmPerDegree * math.Cos(s.Lat*math.Pi/180))
+
+	return Location{
+		Lat: math.Max(-90, math.Min(90, s.Lat+dLat)),
+		Lon: math.Max(-180, math.Min(180, s.Lon+dLon)),
+	}
+}
+
+// densityPoints picks a geohash cell with probability proportional to its number of shops,
+// then a uniform location inside that cell
+type densityPoints struct {
+	cells      []geohash.Hash
+	cumulative []int // cumulative[i] = number of shops in cells[0..i]
+}
+
+func newDensityPoints(shops []Location, cellPrecision uint32) *densityPoints {
+	counts := map[string]int{}
+	cellMap := map[string]geohash.Hash{}
+	for _, s := range shops {
+		h := geohash.ComputeGeohash(geohash.Pos{Lat: s.Lat, Lon: s.Lon}, cellPrecision)
+		key := h.String()
+		counts[key]++
+		cellMap[key] = h
+	}
+
+	// sorted to be independent of map order
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	p := &densityPoints{
+		cells:      make([]geohash.Hash, 0, len(keys)),
+		cumulative: make([]int, 0, len(keys)),
+	}
+	total := 0
+	for _, k := range keys {
+		total += counts[k]
+		p.cells = append(p.cells, cellMap[k])
+		p.cumulative = append(p.cumulative, total)
+	}
+	return p
+}
+
+func (*densityPoints) Name() string {
+	return "density"
+}
+
+func (p *densityPoints) Next() Location {
+	n := rand.Intn(p.cumulative[len(p.cumulative)-1])
+	index := sort.Search(len(p.cumulative), func(i int) bool {
+		return p.cumulative[i] > n
+	})
+
+	rec := p.cells[index].Rec()
+	return Location{
+		Lat: randFloat64(rec.BottomLeft.Lat, rec.TopLeft.Lat),
+		Lon: randFloat64(rec.BottomLeft.Lon, rec.BottomRight.Lon),
+	}
+}
+
+// pointGeneratorNames ...
+var pointGeneratorNames = []string{"line", "uniform", "near_shop", "density"}
+
+// newPointGenerator calls locations only for the generators sampling from the shops
+func newPointGenerator(name string, locations func() ([]Location, error)) (PointGenerator, error) {
+	switch name {
+	case "line":
+		return linePoints{}, nil
+	case "uniform", "near_shop", "density":
+	default:
+		return nil, fmt.Errorf("unknown point generator %q, expected one of %v", name, pointGeneratorNames)
+	}
+
+	shops, err := locations()
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "uniform":
+		return newUniformPoints(boundingBoxOf(shops)), nil
+	case "near_shop":
+		return newNearShopPoints(shops, 0.3), nil
+	default:
+		return newDensityPoints(shops, 5), nil
+	}
+}
+
+func locationsOf(shops []Shop) []Location {
+	result := make([]Location, 0, len(shops))
+	for _, s := range shops {
+		result = append(result, s.Location)
+	}
+	return result
+}
+
+// readShops holds all shops of the file in memory
+func readShops(filename string) ([]Shop, error) {
+	var result []Shop
+	_, err := loadShops(filename, 1000, -1, true, shopWriter{
+		name: "shops",
+		write: func(shops []Shop) error {
+			result = append(result, shops...)
+			return nil
+		},
+	})
+	return result, err
+}
+
+// readShopLocations keeps only the locations of the shops file, to build point generators, ids are not checked
+func readShopLocations(filename string) ([]Location, error) {
+	var locations []Location
+	_, err := loadShops(filename, 1000, -1, false, shopWriter{
+		name: "locations",
+		write: func(shops []Shop) error {
+			for _, s := range shops {
+				locations = append(locations, s.Location)
+			}
+			return nil
+		},
+	})
+	return locations, err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/QuangTung97/geohash"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+var testLocations = []Location{
+	{Lat: 21.0, Lon: 105.8},
+	{Lat: 21.2, Lon: 105.6},
+	{Lat: 20.9, Lon: 106.1},
+	{Lat: 21.0001, Lon: 105.8001},
+}
+
+func TestBoundingBoxOf(t *testing.T) {
+	assert.Equal(t, BoundingBox{
+		MinLat: 20.9,
+		MaxLat: 21.2,
+		MinLon: 105.6,
+		MaxLon: 106.1,
+	}, boundingBoxOf(testLocations))
+}
+
+func TestPointGenerators__Uniform(t *testing.T) {
+	box := boundingBoxOf(testLocations)
+	p := newUniformPoints(box)
+	for i := 0; i < 1000; i++ {
+		assert.True(t, box.contains(p.Next()))
+	}
+}
+
+func TestPointGenerators__Near_Shop(t *testing.T) {
+	p := newNearShopPoints(testLocations, 0.3)
+
+	for i := 0; i < 1000; i++ {
+		l := p.Next()
+		// within 6 sigma of a shop
+		near := false
+		for _, s := range testLocations {
+			if math.Abs(l.Lat-s.Lat) < 6*0.3/kmPerDegree {
+				near = true
+			}
+		}
+		assert.True(t, near)
+	}
+}
+
+func TestPointGenerators__Density(t *testing.T) {
+	p := newDensityPoints(testLocations, 5)
+
+	// the first and last locations share a cell
+	assert.Equal(t, 3, len(p.cells))
+	assert.Equal(t, 4, p.cumulative[len(p.cumulative)-1])
+
+	cellCounts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		l := p.Next()
+		h := geohash.ComputeGeohash(geohash.Pos{Lat: l.Lat, Lon: l.Lon}, 5)
+		cellCounts[h.String()]++
+	}
+
+	dense := geohash.ComputeGeohash(geohash.Pos{Lat: 21.0, Lon: 105.8}, 5).String()
+	assert.Equal(t, 3, len(cellCounts))
+	assert.InDelta(t, 2000, cellCounts[dense], 200)
+}
+
+func TestNewPointGenerator(t *testing.T) {
+	calls := 0
+	locations := func() ([]Location, error) {
+		calls++
+		return testLocations, nil
+	}
+
+	for _, name := range pointGeneratorNames {
+		p, err := newPointGenerator(name, locations)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, name, p.Name())
+	}
+	// not for line
+	assert.Equal(t, len(pointGeneratorNames)-1, calls)
+
+	_, err := newPointGenerator("unknown", locations)
+	assert.Error(t, err)
+	assert.Equal(t, len(pointGeneratorNames)-1, calls)
+
+	_, err = newPointGenerator("uniform", func() ([]Location, error) {
+		return nil, assert.AnError
+	})
+	assert.Equal(t, assert.AnError, err)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bench_elastic/util"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	minPrecision = 4
+	maxPrecision = 8
+
+	// storedPrecision is the precision of the MySQL geohash column, coarser cells are prefixes of it.
+	// Tables loaded with another precision must be reloaded, see errReloadRequired
+	storedPrecision = maxPrecision
+
+	// defaultMaxCells is a 3x3 block, more cells fetch less unused shops but cost more keys per query
+	defaultMaxCells = 9
+)
+
+var allPrecisions = []uint32{4, 5, 6, 7, 8}
+
+// cellSizeKm is the width and height of a geohash cell around latitude lat
+func cellSizeKm(p uint32, lat float64) (float64, float64) {
+	bits := 5 * p
+	latBits := bits / 2
+	lonBits := bits - latBits
+
+	heightDeg := 180 / math.Pow(2, float64(latBits))
+	widthDeg := 360 / math.Pow(2, float64(lonBits))
+
+	return widthDeg * kmPerDegree * math.Cos(lat*math.Pi/180), heightDeg * kmPerDegree
+}
+
+// estimateCells is the worst case number of cells of precision p intersecting a circle of radius km
+func estimateCells(radius float64, lat float64, p uint32) int {
+	w, h := cellSizeKm(p, lat)
+	nx := int(math.Ceil(2*radius/w)) + 1
+	ny := int(math.Ceil(2*radius/h)) + 1
+	return nx * ny
+}
+
+// overFetchRatio is the area of the fetched cells over the area of the circle
+func overFetchRatio(radius float64, lat float64, p uint32) float64 {
+	w, h := cellSizeKm(p, lat)
+	return float64(estimateCells(radius, lat, p)) * w * h / (math.Pi * radius * radius)
+}
+
+// choosePrecision returns the finest available precision that needs at most maxCells cells,
+// finer cells over-fetch less. Falls back to the coarsest available one
+func choosePrecision(radius float64, lat float64, maxCells int, available []uint32) uint32 {
+	sorted := make([]uint32, len(available))
+	copy(sorted, available)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+
+	for _, p := range sorted {
+		if estimateCells(radius, lat, p) <= maxCells {
+			return p
+		}
+	}
+	return sorted[len(sorted)-1]
+}
+
+// closestPrecision is the available precision closest to p, used by the ring expansion of nearest
+func closestPrecision(p uint32, available []uint32) uint32 {
+	result := available[0]
+	for _, a := range available {
+		if absDiff(a, p) < absDiff(result, p) {
+			result = a
+		}
+	}
+	return result
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// PrecisionSweepRow is one precision with one radius
+type PrecisionSweepRow struct {
+	Precision uint32
+	Buckets   int
+	Radius    float64
+	Result    util.BenchResult
+
+	// EstOverFetch is overFetchRatio at the average latitude of the shops
+	EstOverFetch float64
+
+	Candidates int64
+	Shops      int64
+}
+
+func (r PrecisionSweepRow) AvgCandidates() float64 {
+	return float64(r.Candidates) / float64(r.Result.Requests)
+}
+
+func (r PrecisionSweepRow) AvgShops() float64 {
+	return float64(r.Shops) / float64(r.Result.Requests)
+}
+
+// runPrecisionSweep rebuilds the memcache buckets at every precision then searches each radius on them
+func runPrecisionSweep(
+	client *memcacheCluster, shops []Shop, points PointGenerator, radii []float64,
+	requestsPerThread int, numThreads int,
+) ([]PrecisionSweepRow, error) {
+	var avgLat float64
+	for _, s := range shops {
+		avgLat += s.Location.Lat / float64(len(shops))
+	}
+
+	var rows []PrecisionSweepRow
+	for _, p := range allPrecisions {
+		b := newMemcacheGeohashBackend(client, p)
+
+		buckets, err := b.rebuild(shops)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, radius := range radii {
+			var totalShops atomic.Int64
+			b.scanned.Store(0)
+
+			result := util.RunConcurrent(requestsPerThread, numThreads, func() {
+				pos := points.Next()
+				found, err := b.Nearby(pos.Lat, pos.Lon, radius)
+				if err != nil {
+					panic(err)
+				}
+				totalShops.Add(int64(len(found)))
+			})
+
+			rows = append(rows, PrecisionSweepRow{
+				Precision: p,
+				Buckets:   buckets,
+				Radius:    radius,
+				Result:    result,
+
+				EstOverFetch: overFetchRatio(radius, avgLat, p),
+
+				Candidates: b.scanned.Load(),
+				Shops:      totalShops.Load(),
+			})
+		}
+	}
+	return rows, nil
+}
+
+func printPrecisionSweep(rows []PrecisionSweepRow) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	_, _ = fmt.Fprintln(w, "PRECISION\tBUCKETS\tRADIUS\tEST OVER-FETCH\tAVG CANDIDATES\tAVG SHOPS\tP50\tP99\tQPS\t")
+	for _, r := range rows {
+		_, _ = fmt.Fprintf(w, "%d\t%d\t%v\t%.1f\t%.1f\t%.1f\t%v\t%v\t%.1f\t\n",
+			r.Precision, r.Buckets, r.Radius, r.EstOverFetch, r.AvgCandidates(), r.AvgShops(),
+			r.Result.Percentile(50).Round(time.Microsecond),
+			r.Result.Percentile(99).Round(time.Microsecond),
+			r.Result.QPS(),
+		)
+	}
+	_ = w.Flush()
+}
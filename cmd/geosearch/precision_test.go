@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/QuangTung97/geohash"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCellSizeKm__Same_As_Geohash_Rectangle(t *testing.T) {
+	for _, p := range allPrecisions {
+		rec := geohash.ComputeGeohash(geohash.Pos{Lat: 21.0, Lon: 105.8}, p).Rec()
+
+		w, h := cellSizeKm(p, 21.0)
+		assert.InDelta(t, (rec.TopLeft.Lat-rec.BottomLeft.Lat)*kmPerDegree, h, 1e-9)
+		assert.InEpsilon(t, distanceKm(
+			Location{Lat: rec.BottomLeft.Lat, Lon: rec.BottomLeft.Lon},
+			Location{Lat: rec.BottomRight.Lat, Lon: rec.BottomRight.Lon},
+		), w, 0.01)
+	}
+}
+
+func TestChoosePrecision(t *testing.T) {
+	// the original fixed precision for 0.5km
+	assert.Equal(t, uint32(6), choosePrecision(0.5, 21.0, defaultMaxCells, allPrecisions))
+
+	assert.Equal(t, uint32(8), choosePrecision(0.01, 21.0, defaultMaxCells, allPrecisions))
+	assert.Equal(t, uint32(5), choosePrecision(2, 21.0, defaultMaxCells, allPrecisions))
+	assert.Equal(t, uint32(4), choosePrecision(500, 21.0, defaultMaxCells, allPrecisions))
+
+	// only what is available
+	assert.Equal(t, uint32(5), choosePrecision(0.01, 21.0, defaultMaxCells, []uint32{4, 5}))
+
+	// more cells allowed, finer cells
+	assert.Equal(t, uint32(7), choosePrecision(0.5, 21.0, 100, allPrecisions))
+}
+
+func TestOverFetchRatio__Decreases_With_Precision(t *testing.T) {
+	assert.Greater(t, overFetchRatio(0.5, 21.0, 5), overFetchRatio(0.5, 21.0, 6))
+	assert.Greater(t, overFetchRatio(0.5, 21.0, 6), overFetchRatio(0.5, 21.0, 7))
+}
+
+func TestClosestPrecision(t *testing.T) {
+	assert.Equal(t, uint32(6), closestPrecision(6, allPrecisions))
+	assert.Equal(t, uint32(5), closestPrecision(6, []uint32{4, 5}))
+	assert.Equal(t, uint32(8), closestPrecision(6, []uint32{8}))
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bench_elastic/util"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/QuangTung97/go-memcache/memcache"
+)
+
+const (
+	maxCASRetries = 20
+
+	// vivifyTTL is the lifetime in seconds of the empty item created by a get on a missing bucket,
+	// so that the first writers of a bucket also conflict instead of overwriting each other
+	vivifyTTL = 30
+)
+
+var errTooManyCASRetries = errors.New("too many cas retries")
+
+// updateMetrics counts the read-modify-write of buckets
+type updateMetrics struct {
+	bucketWrites atomic.Int64
+	conflicts    atomic.Int64
+	failures     atomic.Int64
+}
+
+// updateBucket applies fn to the shops of the bucket, retrying from the read when the CAS does not match.
+// When the bucket is split it goes down to the child containing l, buckets are only split by a rebuild
+func (b *memcacheGeohashBackend) updateBucket(key string, l Location, fn func(shops []ShopModel) []ShopModel) error {
+	for retry := 0; retry < maxCASRetries; {
+		ok, split, err := b.tryUpdateBucket(key, fn)
+		if err != nil {
+			b.updates.failures.Add(1)
+			return err
+		}
+		if split {
+			key = childKey(l, key)
+			continue
+		}
+		if ok {
+			b.updates.bucketWrites.Add(1)
+			return nil
+		}
+		b.updates.conflicts.Add(1)
+		retry++
+	}
+
+	b.updates.failures.Add(1)
+	return errTooManyCASRetries
+}
+
+func (b *memcacheGeohashBackend) tryUpdateBucket(
+	key string, fn func(shops []ShopModel) []ShopModel,
+) (ok bool, split bool, err error) {
+	p := b.client.Pipeline()
+	defer p.Finish()
+
+	resp, err := p.MGet(key, memcache.MGetOptions{N: vivifyTTL, CAS: true})()
+	if err != nil {
+		return false, false, err
+	}
+
+	// a vivified item has empty data, the same as an empty bucket
+	var shops []ShopModel
+	if resp.Type == memcache.MGetResponseTypeVA {
+		if isSplitMarker(resp.Data) {
+			return false, true, nil
+		}
+		shops, err = unmarshalShopEntry(resp.Data)
+		if err != nil {
+			return false, false, err
+		}
+	}
+
+	setResp, err := p.MSet(key, marshalShopEntry(fn(shops)), memcache.MSetOptions{CAS: resp.CAS})()
+	if err != nil {
+		return false, false, err
+	}
+	// EX: modified by another writer, NF: evicted or expired since the read
+	return setResp.Type == memcache.MSetResponseTypeHD, false, nil
+}
+
+func withoutShop(shops []ShopModel, id int64) []ShopModel {
+	result := make([]ShopModel, 0, len(shops))
+	for _, s := range shops {
+		if s.ID != id {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// withoutShopAt removes the shop only at the old location, a move within a bucket keeps the new one
+func withoutShopAt(shops []ShopModel, id int64, l Location) []ShopModel {
+	result := make([]ShopModel, 0, len(shops))
+	for _, s := range shops {
+		if s.ID != id || s.Lat != l.Lat || s.Lon != l.Lon {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// AddShop adds or replaces the shop in its bucket of every precision
+func (b *memcacheGeohashBackend) AddShop(shop Shop) error {
+	for _, p := range b.precisions {
+		m := shop.toModel(p)
+		err := b.updateBucket(m.Geohash, shop.Location, func(shops []ShopModel) []ShopModel {
+			return append(withoutShop(shops, m.ID), m)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveShop removes the shop from the buckets of its location
+func (b *memcacheGeohashBackend) RemoveShop(shop Shop) error {
+	for _, p := range b.precisions {
+		m := shop.toModel(p)
+		err := b.updateBucket(m.Geohash, shop.Location, func(shops []ShopModel) []ShopModel {
+			return withoutShop(shops, m.ID)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveShop adds the shop at the new location before removing it from the old buckets,
+// a concurrent search can see it twice but never misses it
+func (b *memcacheGeohashBackend) MoveShop(shop Shop, to Location) error {
+	moved := shop
+	moved.Location = to
+
+	if err := b.AddShop(moved); err != nil {
+		return err
+	}
+
+	// the buckets of a split cell differ below the precision, only the same smallest cell is the same bucket
+	if shop.toModel(maxPrecision).Geohash == moved.toModel(maxPrecision).Geohash {
+		return nil
+	}
+
+	for _, p := range b.precisions {
+		from := shop.toModel(p)
+		if from.Geohash == moved.toModel(p).Geohash && b.maxBucketShops <= 0 {
+			continue
+		}
+		err := b.updateBucket(from.Geohash, shop.Location, func(shops []ShopModel) []ShopModel {
+			return withoutShopAt(shops, from.ID, shop.Location)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateBenchResult ...
+type UpdateBenchResult struct {
+	Result util.BenchResult
+
+	BucketWrites int64
+	Conflicts    int64
+	Failures     int64
+}
+
+// ConflictRate is the fraction of bucket writes attempts rejected by CAS
+func (r UpdateBenchResult) ConflictRate() float64 {
+	attempts := r.BucketWrites + r.Conflicts
+	if attempts == 0 {
+		return 0
+	}
+	return float64(r.Conflicts) / float64(attempts)
+}
+
+func (r UpdateBenchResult) Print() {
+	fmt.Println("=========================================")
+	fmt.Println("MOVE SHOPS")
+	r.Result.Print()
+	fmt.Println("BUCKET WRITES:", r.BucketWrites)
+	fmt.Println("CONFLICTS:", r.Conflicts)
+	fmt.Printf("CONFLICT RATE: %.4f\n", r.ConflictRate())
+	fmt.Println("FAILURES:", r.Failures)
+}
+
+// jitter moves l by a gaussian offset of sigma km in each direction
+func jitter(l Location, sigmaKm float64) Location {
+	dLat := rand.NormFloat64() * sigmaKm / kmPerDegree
+	dLon := rand.NormFloat64() * sigmaKm / (kmPerDegree * math.Cos(l.Lat*math.Pi/180))
+	return Location{
+		Lat: clamp(l.Lat+dLat, -90, 90),
+		Lon: clamp(l.Lon+dLon, -180, 180),
+	}
+}
+
+// runUpdateBench moves shops concurrently by about moveKm, the shops must already be in the buckets.
+// Conflicts only come from different shops sharing buckets. It returns the final locations of the shops
+func runUpdateBench(
+	b *memcacheGeohashBackend, shops []Shop, moveKm float64,
+	requestsPerThread int, numThreads int,
+) (UpdateBenchResult, []Shop) {
+	current := make([]Shop, len(shops))
+	copy(current, shops)
+
+	owned := make([][]int, numThreads)
+	for i := range current {
+		owned[i%numThreads] = append(owned[i%numThreads], i)
+	}
+
+	before := UpdateBenchResult{
+		BucketWrites: b.updates.bucketWrites.Load(),
+		Conflicts:    b.updates.conflicts.Load(),
+		Failures:     b.updates.failures.Load(),
+	}
+
+	// each call borrows one set of shops, a shop is never moved by two goroutines at the same time
+	threadShops := make(chan []int, numThreads)
+	for _, indices := range owned {
+		threadShops <- indices
+	}
+
+	result := util.RunConcurrent(requestsPerThread, numThreads, func() {
+		indices := <-threadShops
+		defer func() { threadShops <- indices }()
+
+		if len(indices) == 0 {
+			return
+		}
+		i := indices[rand.Intn(len(indices))]
+
+		to := jitter(current[i].Location, moveKm)
+		if err := b.MoveShop(current[i], to); err != nil {
+			return
+		}
+		current[i].Location = to
+	})
+
+	return UpdateBenchResult{
+		Result:       result,
+		BucketWrites: b.updates.bucketWrites.Load() - before.BucketWrites,
+		Conflicts:    b.updates.conflicts.Load() - before.Conflicts,
+		Failures:     b.updates.failures.Load() - before.Failures,
+	}, current
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithoutShop(t *testing.T) {
+	shops := []ShopModel{{ID: 1}, {ID: 2}, {ID: 3}}
+	assert.Equal(t, []ShopModel{{ID: 1}, {ID: 3}}, withoutShop(shops, 2))
+	assert.Equal(t, []ShopModel{{ID: 1}, {ID: 2}, {ID: 3}}, withoutShop(shops, 4))
+}
+
+func TestUpdateBenchResult_ConflictRate(t *testing.T) {
+	assert.Equal(t, 0.0, UpdateBenchResult{}.ConflictRate())
+	assert.Equal(t, 0.25, UpdateBenchResult{BucketWrites: 30, Conflicts: 10}.ConflictRate())
+}
+
+func TestMemcacheGeohashBackend__Concurrent_Moves(t *testing.T) {
+	client := newMemcacheCluster(memcacheAddrs, 8)
+	defer func() { _ = client.Close() }()
+
+	var shops []Shop
+	for i := 0; i < 50; i++ {
+		shops = append(shops, Shop{
+			ID:       int64(900000000 + i),
+			Location: jitter(Location{Lat: 21.0, Lon: 105.8}, 0.3),
+		})
+	}
+
+	b := newMemcacheGeohashBackend(client, 6, 7)
+	for _, s := range shops {
+		assert.Equal(t, nil, b.RemoveShop(s))
+		assert.Equal(t, nil, b.AddShop(s))
+	}
+
+	result, final := runUpdateBench(b, shops, 0.3, 50, 10)
+	result.Print()
+	assert.Equal(t, int64(0), result.Failures)
+
+	// every shop is found exactly once, at its final location
+	nearby, err := b.Nearby(21.0, 105.8, 20)
+	assert.Equal(t, nil, err)
+	counts := map[int64]int{}
+	for _, n := range nearby {
+		counts[n.ID]++
+	}
+
+	for _, s := range final {
+		assert.Equal(t, 1, counts[s.ID])
+
+		found, err := b.Nearest(s.Location.Lat, s.Location.Lon, 1)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, s.ID, found[0].ID)
+	}
+
+	for _, s := range final {
+		assert.Equal(t, nil, b.RemoveShop(s))
+	}
+}
+
+func TestWithoutShopAt(t *testing.T) {
+	shops := []ShopModel{{ID: 1, Lat: 21}, {ID: 1, Lat: 22}, {ID: 2, Lat: 21}}
+	assert.Equal(t, []ShopModel{{ID: 1, Lat: 22}, {ID: 2, Lat: 21}}, withoutShopAt(shops, 1, Location{Lat: 21}))
+}
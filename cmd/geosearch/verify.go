@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// bruteForceBackend scans all shops for every query, it is the reference of the verification.
+// Load must be done before any search
+type bruteForceBackend struct {
+	shops []Shop
+}
+
+func newBruteForceBackend() *bruteForceBackend {
+	return &bruteForceBackend{}
+}
+
+func (*bruteForceBackend) Name() string {
+	return "brute_force"
+}
+
+func (b *bruteForceBackend) Load(shops []Shop) error {
+	b.shops = append(b.shops, shops...)
+	return nil
+}
+
+func (b *bruteForceBackend) Nearby(lat, lon, radius float64) ([]Shop, error) {
+	origin := Location{Lat: lat, Lon: lon}
+
+	var result []Shop
+	for _, s := range b.shops {
+		if distanceKm(origin, s.Location) <= radius {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (b *bruteForceBackend) Nearest(lat, lon float64, n int) ([]Shop, error) {
+	if n < 1 {
+		return nil, nil
+	}
+	origin := Location{Lat: lat, Lon: lon}
+
+	result := make([]Shop, len(b.shops))
+	copy(result, b.shops)
+	sortByDistance(origin, result)
+
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result, nil
+}
+
+func (b *bruteForceBackend) InBox(box BoundingBox) ([]Shop, error) {
+	var result []Shop
+	for _, s := range b.shops {
+		if box.contains(s.Location) {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (b *bruteForceBackend) InPolygon(polygon []Location) ([]Shop, error) {
+	var result []Shop
+	for _, s := range b.shops {
+		if pointInPolygon(s.Location, polygon) {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+// boundaryToleranceKm ignores differences of shops at the edge of the result,
+// Elasticsearch and the haversine package do not use the same earth radius
+const boundaryToleranceKm = 0.001
+
+// VerifyMismatch is one offending query point
+type VerifyMismatch struct {
+	Pos     Location
+	Missing []int64
+	Extra   []int64
+}
+
+// VerifyReport compares one backend with the brute force scan
+type VerifyReport struct {
+	Backend string
+	Query   string
+	Points  int
+
+	Expected int64
+	Returned int64
+	Matched  int64
+
+	// BoundaryTies are differences within boundaryToleranceKm of the boundary, not counted as errors
+	BoundaryTies int64
+
+	Mismatches []VerifyMismatch
+}
+
+func (r VerifyReport) Recall() float64 {
+	if r.Expected == 0 {
+		return 1
+	}
+	return float64(r.Matched) / float64(r.Expected)
+}
+
+func (r VerifyReport) Precision() float64 {
+	if r.Returned == 0 {
+		return 1
+	}
+	return float64(r.Matched) / float64(r.Returned)
+}
+
+func (r VerifyReport) Print(maxMismatches int) {
+	fmt.Println("=========================================")
+	fmt.Println("BACKEND:", r.Backend)
+	fmt.Println("QUERY:", r.Query)
+	fmt.Println("POINTS:", r.Points)
+	fmt.Printf("RECALL: %.5f (%d / %d)\n", r.Recall(), r.Matched, r.Expected)
+	fmt.Printf("PRECISION: %.5f (%d / %d)\n", r.Precision(), r.Matched, r.Returned)
+	fmt.Println("BOUNDARY TIES:", r.BoundaryTies)
+	fmt.Println("OFFENDING POINTS:", len(r.Mismatches))
+
+	for i, m := range r.Mismatches {
+		if i >= maxMismatches {
+			fmt.Println("  ...")
+			break
+		}
+		fmt.Printf("  lat=%v lon=%v missing=%v extra=%v\n", m.Pos.Lat, m.Pos.Lon, m.Missing, m.Extra)
+	}
+}
+
+func diffShops(pos Location, boundary float64, expected []Shop, returned []Shop, report *VerifyReport) {
+	expectedSet := map[int64]Shop{}
+	for _, s := range expected {
+		expectedSet[s.ID] = s
+	}
+	returnedSet := map[int64]Shop{}
+	for _, s := range returned {
+		returnedSet[s.ID] = s
+	}
+
+	isTie := func(s Shop) bool {
+		return math.Abs(distanceKm(pos, s.Location)-boundary) <= boundaryToleranceKm
+	}
+
+	var mismatch VerifyMismatch
+	for id, s := range expectedSet {
+		if _, ok := returnedSet[id]; ok {
+			report.Matched++
+			continue
+		}
+		if isTie(s) {
+			report.BoundaryTies++
+			continue
+		}
+		mismatch.Missing = append(mismatch.Missing, id)
+	}
+	for id, s := range returnedSet {
+		if _, ok := expectedSet[id]; ok {
+			continue
+		}
+		if isTie(s) {
+			report.BoundaryTies++
+			continue
+		}
+		mismatch.Extra = append(mismatch.Extra, id)
+	}
+
+	report.Expected += int64(len(expectedSet))
+	report.Returned += int64(len(returnedSet))
+
+	if len(mismatch.Missing) > 0 || len(mismatch.Extra) > 0 {
+		sort.Slice(mismatch.Missing, func(i, j int) bool { return mismatch.Missing[i] < mismatch.Missing[j] })
+		sort.Slice(mismatch.Extra, func(i, j int) bool { return mismatch.Extra[i] < mismatch.Extra[j] })
+		mismatch.Pos = pos
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+}
+
+// verifyBackends runs the same numPoints query points against the reference and every backend
+func verifyBackends(
+	reference GeoBackend, backends []GeoBackend,
+	query GeoQuery, points PointGenerator, numPoints int,
+) ([]VerifyReport, error) {
+	reports := make([]VerifyReport, 0, len(backends))
+	for _, b := range backends {
+		reports = append(reports, VerifyReport{
+			Backend: b.Name(),
+			Query:   query.Name,
+			Points:  numPoints,
+		})
+	}
+
+	for i := 0; i < numPoints; i++ {
+		pos := points.Next()
+
+		expected, err := query.Run(reference, pos)
+		if err != nil {
+			return nil, err
+		}
+		boundary := math.NaN()
+		if query.Boundary != nil {
+			boundary = query.Boundary(pos, expected)
+		}
+
+		for k, b := range backends {
+			returned, err := query.Run(b, pos)
+			if err != nil {
+				return nil, fmt.Errorf("backend %s: %w", b.Name(), err)
+			}
+			diffShops(pos, boundary, expected, returned, &reports[k])
+		}
+	}
+	return reports, nil
+}
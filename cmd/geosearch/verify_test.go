@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// skipShopBackend loses one shop, like a missing memcache bucket
+type skipShopBackend struct {
+	*bruteForceBackend
+	skipID int64
+}
+
+func (b *skipShopBackend) Nearby(lat, lon, radius float64) ([]Shop, error) {
+	shops, _ := b.bruteForceBackend.Nearby(lat, lon, radius)
+
+	result := make([]Shop, 0, len(shops))
+	for _, s := range shops {
+		if s.ID != b.skipID {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+type fixedPoints struct {
+	pos Location
+}
+
+func (fixedPoints) Name() string {
+	return "fixed"
+}
+
+func (p fixedPoints) Next() Location {
+	return p.pos
+}
+
+func TestVerifyBackends(t *testing.T) {
+	shops := []Shop{
+		{ID: 1, Location: Location{Lat: 21.0, Lon: 105.8}},
+		{ID: 2, Location: Location{Lat: 21.001, Lon: 105.8}},
+		{ID: 3, Location: Location{Lat: 21.002, Lon: 105.8}},
+		{ID: 4, Location: Location{Lat: 21.5, Lon: 105.8}},
+	}
+
+	reference := newBruteForceBackend()
+	_ = reference.Load(shops)
+
+	good := newBruteForceBackend()
+	_ = good.Load(shops)
+
+	bad := &skipShopBackend{bruteForceBackend: newBruteForceBackend(), skipID: 2}
+	_ = bad.Load(shops)
+
+	pos := Location{Lat: 21.0, Lon: 105.8}
+	reports, err := verifyBackends(reference, []GeoBackend{good, bad}, nearbyQuery(0.5), fixedPoints{pos: pos}, 2)
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, 1.0, reports[0].Recall())
+	assert.Equal(t, 1.0, reports[0].Precision())
+	assert.Equal(t, 0, len(reports[0].Mismatches))
+
+	assert.Equal(t, int64(6), reports[1].Expected)
+	assert.Equal(t, int64(4), reports[1].Matched)
+	assert.Equal(t, 1.0, reports[1].Precision())
+	assert.Equal(t, []VerifyMismatch{
+		{Pos: pos, Missing: []int64{2}},
+		{Pos: pos, Missing: []int64{2}},
+	}, reports[1].Mismatches)
+}
+
+func TestDiffShops__Boundary_Tie(t *testing.T) {
+	pos := Location{Lat: 21.0, Lon: 105.8}
+	edge := Shop{ID: 1, Location: Location{Lat: 21.0, Lon: 105.8}}
+
+	var report VerifyReport
+	diffShops(pos, 0.0005, []Shop{edge}, nil, &report)
+
+	assert.Equal(t, int64(1), report.BoundaryTies)
+	assert.Equal(t, 0, len(report.Mismatches))
+}
+
+func TestBruteForceBackend_Nearest(t *testing.T) {
+	b := newBruteForceBackend()
+	_ = b.Load([]Shop{
+		{ID: 1, Location: Location{Lat: 21.003, Lon: 105.8}},
+		{ID: 2, Location: Location{Lat: 21.001, Lon: 105.8}},
+		{ID: 3, Location: Location{Lat: 21.002, Lon: 105.8}},
+	})
+
+	result, err := b.Nearest(21.0, 105.8, 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int64{2, 3}, []int64{result[0].ID, result[1].ID})
+	assert.Equal(t, int64(1), b.shops[0].ID)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bench_elastic/caching"
+	"context"
+	"flag"
+)
+
+func main() {
+	numProducts := flag.Int("products", 0, "number of products, 0 is the same number as the elasticsearch load")
+	batchSize := flag.Int("batch", 1000, "number of products per insert")
+	parallelism := flag.Int("parallel", 8, "number of concurrent inserts")
+	schemaOnly := flag.Bool("schema-only", false, "only apply the schema")
+	flag.Parse()
+
+	ctx := context.Background()
+	db := caching.NewDB()
+
+	if err := caching.ApplySchema(ctx, db); err != nil {
+		panic(err)
+	}
+	if *schemaOnly {
+		return
+	}
+
+	err := caching.SeedProducts(ctx, caching.NewRepository(db), *numProducts, *batchSize, *parallelism)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const kmPerDegree = 111.32
+
+// City is a centre of shops, the density of shops falls off exponentially with the distance to the centre
+type City struct {
+	Name string
+	Lat  float64
+	Lon  float64
+
+	// Weight is the relative number of shops of the city
+	Weight float64
+	// ScaleKm is the distance at which the density falls to 1/e of the centre
+	ScaleKm float64
+}
+
+// defaultCities are the largest cities of Vietnam, the same region as shops.csv
+var defaultCities = []City{
+	{Name: "hanoi", Lat: 21.0285, Lon: 105.8542, Weight: 0.35, ScaleKm: 4},
+	{Name: "hcmc", Lat: 10.7769, Lon: 106.7009, Weight: 0.4, ScaleKm: 5},
+	{Name: "danang", Lat: 16.0544, Lon: 108.2022, Weight: 0.1, ScaleKm: 3},
+	{Name: "haiphong", Lat: 20.8449, Lon: 106.6881, Weight: 0.08, ScaleKm: 3},
+	{Name: "cantho", Lat: 10.0452, Lon: 105.7469, Weight: 0.07, ScaleKm: 2.5},
+}
+
+// parseCities reads cities in the format name:lat:lon:weight:scaleKm, separated by commas
+func parseCities(list string) ([]City, error) {
+	if list == "" {
+		return nil, errNoCities
+	}
+
+	var result []City
+	for _, s := range strings.Split(list, ",") {
+		fields := strings.Split(s, ":")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid city %q, expected name:lat:lon:weight:scaleKm", s)
+		}
+
+		values := make([]float64, 0, 4)
+		for _, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid city %q: %w", s, err)
+			}
+			values = append(values, v)
+		}
+
+		c := City{Name: fields[0], Lat: values[0], Lon: values[1], Weight: values[2], ScaleKm: values[3]}
+		if c.Lat < -90 || c.Lat > 90 || c.Lon < -180 || c.Lon > 180 {
+			return nil, fmt.Errorf("invalid city %q: location out of range", s)
+		}
+		if c.Weight <= 0 || c.ScaleKm <= 0 {
+			return nil, fmt.Errorf("invalid city %q: weight and scale must be positive", s)
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// GeneratorConfig ...
+type GeneratorConfig struct {
+	Cities []City
+	Seed   int64
+
+	// HotspotsPerCity are the markets and shopping streets of a city, drawn from the density of the city
+	HotspotsPerCity int
+	// HotspotFraction of the shops are within about HotspotKm of a hotspot
+	HotspotFraction float64
+	HotspotKm       float64
+
+	// RuralFraction of the shops are uniform in the bounding box of the cities, around RuralMarginKm wider
+	RuralFraction float64
+	RuralMarginKm float64
+}
+
+func defaultGeneratorConfig() GeneratorConfig {
+	return GeneratorConfig{
+		Cities:          defaultCities,
+		Seed:            1,
+		HotspotsPerCity: 50,
+		HotspotFraction: 0.3,
+		HotspotKm:       0.2,
+		RuralFraction:   0.05,
+		RuralMarginKm:   20,
+	}
+}
+
+var errNoCities = errors.New("no cities")
+
+type point struct {
+	lat float64
+	lon float64
+}
+
+// ShopGenerator is deterministic for the same config
+type ShopGenerator struct {
+	conf GeneratorConfig
+	rnd  *rand.Rand
+
+	cumWeights []float64
+	hotspots   [][]point
+
+	minLat, maxLat float64
+	minLon, maxLon float64
+}
+
+func newShopGenerator(conf GeneratorConfig) (*ShopGenerator, error) {
+	if len(conf.Cities) == 0 {
+		return nil, errNoCities
+	}
+
+	g := &ShopGenerator{
+		conf:   conf,
+		rnd:    rand.New(rand.NewSource(conf.Seed)),
+		minLat: 90, maxLat: -90,
+		minLon: 180, maxLon: -180,
+	}
+
+	total := 0.0
+	for _, c := range conf.Cities {
+		total += c.Weight
+		g.cumWeights = append(g.cumWeights, total)
+
+		g.minLat = math.Min(g.minLat, c.Lat)
+		g.maxLat = math.Max(g.maxLat, c.Lat)
+		g.minLon = math.Min(g.minLon, c.Lon)
+		g.maxLon = math.Max(g.maxLon, c.Lon)
+	}
+
+	marginLat := conf.RuralMarginKm / kmPerDegree
+	marginLon := conf.RuralMarginKm / (kmPerDegree * math.Cos(g.maxAbsLat()*math.Pi/180))
+	g.minLat = math.Max(g.minLat-marginLat, -90)
+	g.maxLat = math.Min(g.maxLat+marginLat, 90)
+	g.minLon = math.Max(g.minLon-marginLon, -180)
+	g.maxLon = math.Min(g.maxLon+marginLon, 180)
+
+	for _, c := range conf.Cities {
+		spots := make([]point, 0, conf.HotspotsPerCity)
+		for i := 0; i < conf.HotspotsPerCity; i++ {
+			spots = append(spots, g.aroundCity(c))
+		}
+		g.hotspots = append(g.hotspots, spots)
+	}
+	return g, nil
+}
+
+func (g *ShopGenerator) maxAbsLat() float64 {
+	return math.Min(math.Max(math.Abs(g.minLat), math.Abs(g.maxLat)), 89)
+}
+
+func (g *ShopGenerator) pickCity() int {
+	r := g.rnd.Float64() * g.cumWeights[len(g.cumWeights)-1]
+	for i, w := range g.cumWeights {
+		if r < w {
+			return i
+		}
+	}
+	return len(g.cumWeights) - 1
+}
+
+// offset moves p by dx km to the east and dy km to the north, on a local flat approximation
+func offset(p point, dx, dy float64) point {
+	lat := p.lat + dy/kmPerDegree
+	lon := p.lon + dx/(kmPerDegree*math.Cos(p.lat*math.Pi/180))
+
+	lat = math.Max(-90, math.Min(90, lat))
+	if lon > 180 {
+		lon -= 360
+	} else if lon < -180 {
+		lon += 360
+	}
+	return point{lat: lat, lon: lon}
+}
+
+// aroundCity draws from a density proportional to exp(-r / ScaleKm), the distance r then follows
+// a gamma distribution of shape 2, the sum of two exponentials
+func (g *ShopGenerator) aroundCity(c City) point {
+	r := -c.ScaleKm * (math.Log(1-g.rnd.Float64()) + math.Log(1-g.rnd.Float64()))
+	angle := g.rnd.Float64() * 2 * math.Pi
+	return offset(point{lat: c.Lat, lon: c.Lon}, r*math.Cos(angle), r*math.Sin(angle))
+}
+
+// Next returns the location of the next shop
+func (g *ShopGenerator) Next() (lat float64, lon float64) {
+	if g.rnd.Float64() < g.conf.RuralFraction {
+		return g.minLat + g.rnd.Float64()*(g.maxLat-g.minLat), g.minLon + g.rnd.Float64()*(g.maxLon-g.minLon)
+	}
+
+	city := g.pickCity()
+	if len(g.hotspots[city]) > 0 && g.rnd.Float64() < g.conf.HotspotFraction {
+		spot := g.hotspots[city][g.rnd.Intn(len(g.hotspots[city]))]
+		p := offset(spot, g.rnd.NormFloat64()*g.conf.HotspotKm, g.rnd.NormFloat64()*g.conf.HotspotKm)
+		return p.lat, p.lon
+	}
+
+	p := g.aroundCity(g.conf.Cities[city])
+	return p.lat, p.lon
+}
+
+// writeShops writes n shops with ids from startID, in the csv format of shops.csv
+func writeShops(w io.Writer, g *ShopGenerator, n int, startID int64) error {
+	bw := bufio.NewWriterSize(w, 1<<20)
+
+	if _, err := bw.WriteString("\"id\",\"lat\",\"lon\"\n"); err != nil {
+		return err
+	}
+
+	line := make([]byte, 0, 64)
+	for i := 0; i < n; i++ {
+		lat, lon := g.Next()
+
+		line = line[:0]
+		line = strconv.AppendInt(line, startID+int64(i), 10)
+		line = append(line, ',')
+		line = strconv.AppendFloat(line, lat, 'f', 7, 64)
+		line = append(line, ',')
+		line = strconv.AppendFloat(line, lon, 'f', 7, 64)
+		line = append(line, '\n')
+
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
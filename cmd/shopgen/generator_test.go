@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func generate(conf GeneratorConfig, n int) []byte {
+	var buf bytes.Buffer
+	g, err := newShopGenerator(conf)
+	if err != nil {
+		panic(err)
+	}
+	if err := writeShops(&buf, g, n, 1); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteShops__Same_Seed_Same_Output(t *testing.T) {
+	conf := defaultGeneratorConfig()
+	assert.Equal(t, generate(conf, 1000), generate(conf, 1000))
+
+	conf.Seed = 2
+	assert.NotEqual(t, generate(defaultGeneratorConfig(), 1000), generate(conf, 1000))
+}
+
+func TestWriteShops__Format(t *testing.T) {
+	rows, err := csv.NewReader(bytes.NewReader(generate(defaultGeneratorConfig(), 100))).ReadAll()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 101, len(rows))
+	assert.Equal(t, []string{"id", "lat", "lon"}, rows[0])
+
+	for i, row := range rows[1:] {
+		assert.Equal(t, strconv.Itoa(i+1), row[0])
+
+		lat, err := strconv.ParseFloat(row[1], 64)
+		assert.Equal(t, nil, err)
+		assert.True(t, lat >= -90 && lat <= 90)
+
+		lon, err := strconv.ParseFloat(row[2], 64)
+		assert.Equal(t, nil, err)
+		assert.True(t, lon >= -180 && lon <= 180)
+	}
+}
+
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	dy := (lat2 - lat1) * kmPerDegree
+	dx := (lon2 - lon1) * kmPerDegree * math.Cos(lat1*math.Pi/180)
+	return math.Sqrt(dx*dx + dy*dy)
+}
+
+func TestShopGenerator__Density_Falloff(t *testing.T) {
+	conf := defaultGeneratorConfig()
+	conf.Cities = []City{
+		{Name: "a", Lat: 21, Lon: 105.8, Weight: 3, ScaleKm: 4},
+		{Name: "b", Lat: 10.8, Lon: 106.7, Weight: 1, ScaleKm: 2},
+	}
+	conf.HotspotFraction = 0
+	conf.RuralFraction = 0
+
+	g, err := newShopGenerator(conf)
+	assert.Equal(t, nil, err)
+
+	var distA, distB []float64
+	for i := 0; i < 100000; i++ {
+		lat, lon := g.Next()
+		if lat > 16 {
+			distA = append(distA, distanceKm(21, 105.8, lat, lon))
+		} else {
+			distB = append(distB, distanceKm(10.8, 106.7, lat, lon))
+		}
+	}
+
+	assert.InDelta(t, 0.75, float64(len(distA))/100000, 0.01)
+
+	// the median of a gamma of shape 2 is about 1.678 scale
+	median := func(d []float64) float64 {
+		sort.Float64s(d)
+		return d[len(d)/2]
+	}
+	assert.InDelta(t, 1.678*4, median(distA), 0.15)
+	assert.InDelta(t, 1.678*2, median(distB), 0.1)
+}
+
+func TestShopGenerator__Rural_In_Area(t *testing.T) {
+	conf := defaultGeneratorConfig()
+	conf.RuralFraction = 1
+
+	g, err := newShopGenerator(conf)
+	assert.Equal(t, nil, err)
+	for i := 0; i < 1000; i++ {
+		lat, lon := g.Next()
+		assert.True(t, lat >= g.minLat && lat <= g.maxLat)
+		assert.True(t, lon >= g.minLon && lon <= g.maxLon)
+	}
+}
+
+func TestParseCities(t *testing.T) {
+	cities, err := parseCities("hanoi:21.03:105.85:2:4,hue:16.46:107.59:0.5:1.5")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []City{
+		{Name: "hanoi", Lat: 21.03, Lon: 105.85, Weight: 2, ScaleKm: 4},
+		{Name: "hue", Lat: 16.46, Lon: 107.59, Weight: 0.5, ScaleKm: 1.5},
+	}, cities)
+
+	_, err = parseCities("hanoi:21.03:105.85:2")
+	assert.NotEqual(t, nil, err)
+
+	_, err = parseCities("hanoi:91:105.85:2:4")
+	assert.NotEqual(t, nil, err)
+
+	_, err = parseCities("hanoi:21.03:105.85:0:4")
+	assert.NotEqual(t, nil, err)
+
+	_, err = parseCities("")
+	assert.Equal(t, errNoCities, err)
+}
+
+func TestNewShopGenerator__No_Cities(t *testing.T) {
+	conf := defaultGeneratorConfig()
+	conf.Cities = nil
+
+	_, err := newShopGenerator(conf)
+	assert.Equal(t, errNoCities, err)
+}
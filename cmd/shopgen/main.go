@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+func main() {
+	numShops := flag.Int("n", 1000000, "number of shops")
+	output := flag.String("out", "-", "output csv file, - is stdout")
+	seed := flag.Int64("seed", 1, "random seed, the same seed and flags give the same file")
+	startID := flag.Int64("start-id", 1, "id of the first shop")
+	cityList := flag.String("cities", "", "comma separated name:lat:lon:weight:scaleKm, empty is the largest cities of Vietnam")
+	hotspots := flag.Int("hotspots", 50, "number of hotspots per city")
+	hotspotFraction := flag.Float64("hotspot-fraction", 0.3, "fraction of the shops around a hotspot")
+	hotspotKm := flag.Float64("hotspot-km", 0.2, "standard deviation in km of the shops around a hotspot")
+	ruralFraction := flag.Float64("rural-fraction", 0.05, "fraction of the shops uniform in the area of the cities")
+	ruralMarginKm := flag.Float64("rural-margin-km", 20, "margin in km around the cities of the area of the rural shops")
+	flag.Parse()
+
+	conf := defaultGeneratorConfig()
+	conf.Seed = *seed
+	conf.HotspotsPerCity = *hotspots
+	conf.HotspotFraction = *hotspotFraction
+	conf.HotspotKm = *hotspotKm
+	conf.RuralFraction = *ruralFraction
+	conf.RuralMarginKm = *ruralMarginKm
+	if *cityList != "" {
+		cities, err := parseCities(*cityList)
+		if err != nil {
+			panic(err)
+		}
+		conf.Cities = cities
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			panic(err)
+		}
+		defer func() { _ = file.Close() }()
+		w = file
+	}
+
+	g, err := newShopGenerator(conf)
+	if err != nil {
+		panic(err)
+	}
+
+	start := time.Now()
+	if err := writeShops(w, g, *numShops, *startID); err != nil {
+		panic(err)
+	}
+	_, _ = fmt.Fprintln(os.Stderr, "SHOPS:", *numShops, "DURATION:", time.Since(start))
+}
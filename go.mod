@@ -10,6 +10,7 @@ require (
 	github.com/elastic/go-elasticsearch/v7 v7.17.7
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/golang/protobuf v1.5.0
+	github.com/golang/snappy v0.0.4
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/stretchr/testify v1.8.1
 	google.golang.org/protobuf v1.28.1
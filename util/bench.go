@@ -2,19 +2,59 @@ package util
 
 import (
 	"fmt"
-	"sort"
 	"sync"
 	"time"
 )
 
-func BenchConcurrent(
+// BenchResult is the statistics of one benchmark run
+type BenchResult struct {
+	Requests      int
+	TotalDuration time.Duration
+
+	// Durations is sorted in increasing order
+	Durations []time.Duration
+}
+
+// Percentile with p in [0, 100]
+func (r BenchResult) Percentile(p float64) time.Duration {
+	return Percentile(r.Durations, p)
+}
+
+// MaxDuration ...
+func (r BenchResult) MaxDuration() time.Duration {
+	if len(r.Durations) == 0 {
+		return 0
+	}
+	return r.Durations[len(r.Durations)-1]
+}
+
+// QPS ...
+func (r BenchResult) QPS() float64 {
+	return float64(r.Requests) / r.TotalDuration.Seconds()
+}
+
+func (r BenchResult) Print() {
+	fmt.Println("TOTAL TIME:", r.TotalDuration)
+
+	printPercentile := func(p float64) {
+		fmt.Printf("PERCENTILE P%.2f: %v\n", p, r.Percentile(p))
+	}
+	printPercentile(50)
+	printPercentile(90)
+	printPercentile(95)
+	printPercentile(99)
+	printPercentile(99.9)
+
+	fmt.Printf("MAX DURATION: %v\n", r.MaxDuration())
+	fmt.Println("QPS:", r.QPS())
+}
+
+// RunConcurrent calls fn requestsPerThread times in each of numThreads goroutines, without printing
+func RunConcurrent(
 	requestsPerThread int,
 	numThreads int,
 	fn func(),
-) {
-	fmt.Println("REQUESTS PER THREAD:", requestsPerThread)
-	fmt.Println("NUM THREADS:", numThreads)
-
+) BenchResult {
 	durations := make([]time.Duration, 0, requestsPerThread*numThreads)
 	var mut sync.Mutex
 
@@ -43,22 +83,24 @@ func BenchConcurrent(
 
 	totalDuration := time.Since(totalStart)
 
-	sort.Slice(durations, func(i, j int) bool {
-		return durations[i] < durations[j]
-	})
+	SortDurations(durations)
 
-	fmt.Println("TOTAL TIME:", totalDuration)
-
-	printPercentile := func(p float64) {
-		index := int(p * float64(len(durations)) / 100.0)
-		fmt.Printf("PERCENTILE P%.2f: %v\n", p, durations[index])
+	return BenchResult{
+		Requests:      numThreads * requestsPerThread,
+		TotalDuration: totalDuration,
+		Durations:     durations,
 	}
-	printPercentile(50)
-	printPercentile(90)
-	printPercentile(95)
-	printPercentile(99)
-	printPercentile(99.9)
+}
+
+func BenchConcurrent(
+	requestsPerThread int,
+	numThreads int,
+	fn func(),
+) BenchResult {
+	fmt.Println("REQUESTS PER THREAD:", requestsPerThread)
+	fmt.Println("NUM THREADS:", numThreads)
 
-	fmt.Printf("MAX DURATION: %v\n", durations[len(durations)-1])
-	fmt.Println("QPS:", float64(numThreads*requestsPerThread)/totalDuration.Seconds())
+	result := RunConcurrent(requestsPerThread, numThreads, fn)
+	result.Print()
+	return result
 }
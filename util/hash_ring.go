@@ -0,0 +1,122 @@
+package util
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// HashRing is a consistent hash ring with virtual nodes, it is immutable and thread safe
+type HashRing[N comparable] struct {
+	nodes  []N
+	points []ringPoint[N]
+}
+
+type ringPoint[N comparable] struct {
+	hash uint64
+	node N
+}
+
+// HashKey is fnv-1a followed by the splitmix64 finalizer, for a better distribution of similar keys
+func HashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	x := h.Sum64()
+
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// NewHashRing places numVirtualNodes points for each node, nodeName must be unique and stable between processes
+func NewHashRing[N comparable](nodes []N, numVirtualNodes int, nodeName func(n N) string) *HashRing[N] {
+	points := make([]ringPoint[N], 0, len(nodes)*numVirtualNodes)
+	for _, n := range nodes {
+		name := nodeName(n)
+		for i := 0; i < numVirtualNodes; i++ {
+			points = append(points, ringPoint[N]{
+				hash: HashKey(name + "#" + strconv.Itoa(i)),
+				node: n,
+			})
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+
+	return &HashRing[N]{
+		nodes:  nodes,
+		points: points,
+	}
+}
+
+// Nodes returns the nodes of the ring
+func (r *HashRing[N]) Nodes() []N {
+	return r.nodes
+}
+
+func (r *HashRing[N]) search(key string) int {
+	h := HashKey(key)
+	index := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	if index == len(r.points) {
+		index = 0
+	}
+	return index
+}
+
+// Get returns the owner node of the key
+func (r *HashRing[N]) Get(key string) N {
+	return r.points[r.search(key)].node
+}
+
+// GetN returns at most n distinct nodes, in the order of the ring starting from the owner of the key
+func (r *HashRing[N]) GetN(key string, n int) []N {
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+
+	result := make([]N, 0, n)
+	r.Walk(key, func(node N) bool {
+		result = append(result, node)
+		return len(result) < n
+	})
+	return result
+}
+
+// Walk calls fn on the distinct nodes in the order of the ring starting from the owner of the key,
+// until fn returns false. It does not allocate while fewer than 8 nodes are visited
+func (r *HashRing[N]) Walk(key string, fn func(node N) bool) {
+	if len(r.points) == 0 {
+		return
+	}
+
+	var buf [8]N
+	seen := buf[:0]
+
+	start := r.search(key)
+	for i := 0; i < len(r.points) && len(seen) < len(r.nodes); i++ {
+		node := r.points[(start+i)%len(r.points)].node
+		if containsNode(seen, node) {
+			continue
+		}
+		seen = append(seen, node)
+		if !fn(node) {
+			return
+		}
+	}
+}
+
+func containsNode[N comparable](nodes []N, node N) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newHashRingTest(nodes ...string) *HashRing[string] {
+	return NewHashRing(nodes, 160, func(n string) string { return n })
+}
+
+func TestHashRing_Get__Distribution(t *testing.T) {
+	r := newHashRingTest("node1", "node2", "node3", "node4")
+
+	const numKeys = 100000
+
+	counts := map[string]int{}
+	for i := 0; i < numKeys; i++ {
+		counts[r.Get(fmt.Sprintf("SKU%08d", i))]++
+	}
+
+	assert.Equal(t, 4, len(counts))
+	for _, c := range counts {
+		assert.Greater(t, c, numKeys/4*8/10)
+		assert.Less(t, c, numKeys/4*12/10)
+	}
+}
+
+func TestHashRing_Get__Rebalance(t *testing.T) {
+	before := newHashRingTest("node1", "node2", "node3", "node4")
+	after := newHashRingTest("node1", "node2", "node3", "node4", "node5")
+
+	const numKeys = 100000
+
+	moved := 0
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("SKU%08d", i)
+		from := before.Get(key)
+		to := after.Get(key)
+		if from != to {
+			assert.Equal(t, "node5", to)
+			moved++
+		}
+	}
+
+	// about 1 / 5 of the keys move to the new node
+	fmt.Println("MOVED RATIO:", float64(moved)/numKeys)
+	assert.Greater(t, moved, numKeys/5*8/10)
+	assert.Less(t, moved, numKeys/5*12/10)
+}
+
+func TestHashRing_GetN(t *testing.T) {
+	r := newHashRingTest("node1", "node2", "node3")
+
+	nodes := r.GetN("SKU00000001", 2)
+	assert.Equal(t, 2, len(nodes))
+	assert.NotEqual(t, nodes[0], nodes[1])
+	assert.Equal(t, r.Get("SKU00000001"), nodes[0])
+
+	assert.Equal(t, 3, len(r.GetN("SKU00000001", 5)))
+}
+
+func TestHashRing_Walk(t *testing.T) {
+	r := newHashRingTest("node1", "node2", "node3")
+
+	var visited []string
+	r.Walk("SKU00000001", func(node string) bool {
+		visited = append(visited, node)
+		return true
+	})
+	assert.Equal(t, r.GetN("SKU00000001", 3), visited)
+
+	visited = nil
+	r.Walk("SKU00000001", func(node string) bool {
+		visited = append(visited, node)
+		return false
+	})
+	assert.Equal(t, []string{r.Get("SKU00000001")}, visited)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Walk("SKU00000001", func(node string) bool { return true })
+	})
+	assert.Equal(t, 0.0, allocs)
+}
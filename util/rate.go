@@ -0,0 +1,42 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out events evenly to at most ratePerSecond, it is thread safe
+type RateLimiter struct {
+	interval time.Duration
+
+	mut  sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter returns nil for ratePerSecond <= 0, a nil limiter does not limit
+func NewRateLimiter(ratePerSecond float64) *RateLimiter {
+	if ratePerSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		interval: time.Duration(float64(time.Second) / ratePerSecond),
+	}
+}
+
+// Wait blocks until n more events are allowed
+func (r *RateLimiter) Wait(n int) {
+	if r == nil {
+		return
+	}
+
+	r.mut.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	waitUntil := r.next
+	r.next = r.next.Add(time.Duration(n) * r.interval)
+	r.mut.Unlock()
+
+	time.Sleep(waitUntil.Sub(now))
+}
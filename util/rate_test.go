@@ -0,0 +1,22 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := NewRateLimiter(1000)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		r.Wait(10)
+	}
+	// the first 10 events are not delayed
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	var nilLimiter *RateLimiter
+	assert.Equal(t, nilLimiter, NewRateLimiter(0))
+	nilLimiter.Wait(100)
+}
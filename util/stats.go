@@ -0,0 +1,25 @@
+package util
+
+import (
+	"sort"
+	"time"
+)
+
+// SortDurations sorts in increasing order
+func SortDurations(durations []time.Duration) {
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+}
+
+// Percentile returns the p-th percentile (p in [0, 100]) of sorted durations
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(p * float64(len(sorted)) / 100.0)
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
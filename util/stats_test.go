@@ -0,0 +1,18 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	durations := []time.Duration{5, 3, 1, 4, 2, 10, 9, 8, 7, 6}
+	SortDurations(durations)
+
+	assert.Equal(t, time.Duration(1), Percentile(durations, 0))
+	assert.Equal(t, time.Duration(6), Percentile(durations, 50))
+	assert.Equal(t, time.Duration(10), Percentile(durations, 99.9))
+	assert.Equal(t, time.Duration(10), Percentile(durations, 100))
+	assert.Equal(t, time.Duration(0), Percentile(nil, 50))
+}